@@ -19,6 +19,8 @@ import (
 	"encoding/json"
 	"fmt"
 	"os"
+	"path/filepath"
+	"sort"
 	"strings"
 	"text/tabwriter"
 	"time"
@@ -33,21 +35,61 @@ var compareCmd = &cobra.Command{
 	Short: "Compare test results",
 	Long: `compare takes one or more JSON files, generated by 'rtf run', and shows them side by side. It optionally creates a CSV file with the results.
 
+With --threshold or --threshold-file, the metrics of each file are compared with those of the first file, the baseline. Metrics which changed by more than their threshold are marked as improved or regressed, depending on their direction, and compare fails if any metric regressed. Metrics without a direction, including numeric RT_BENCHMARK_RESULT values, the metric "benchmark", are marked as changed and only fail the comparison if the threshold file has a threshold for them.
+
 Note, this currently requires the set of tests contained in the JSON files to be identical.`,
 	RunE: compare,
 }
 
 var (
-	csvCompare bool
+	csvCompare           bool
+	compareArtifacts     bool
+	compareSteps         bool
+	compareThreshold     string
+	compareThresholdFile string
 )
 
 func init() {
 	flags := compareCmd.Flags()
 	flags.BoolVarP(&csvCompare, "csv", "", false, "Generate a CSV file")
+	flags.BoolVarP(&compareArtifacts, "artifacts", "", false, "List the artifacts stored by the tests")
+	flags.BoolVarP(&compareSteps, "steps", "", false, "Show the time of each step of the tests")
+	flags.StringVarP(&compareThreshold, "threshold", "", "", "Fail if a metric, or a numeric benchmark result, regressed by more than this percentage, e.g. 10%")
+	flags.StringVarP(&compareThresholdFile, "threshold-file", "", "", "Read thresholds for metrics from a file with one '[test] metric threshold' per line")
 	RootCmd.AddCommand(compareCmd)
 }
 
 func compare(_ *cobra.Command, args []string) error {
+	thresholds, err := readThresholds(compareThreshold, compareThresholdFile)
+	if err != nil {
+		return err
+	}
+	return compareFiles(args, thresholds)
+}
+
+// readThresholds returns the thresholds for metrics from a threshold file
+// and the default threshold, either of which may be empty
+func readThresholds(threshold, file string) (*local.Thresholds, error) {
+	thresholds := &local.Thresholds{}
+	if file != "" {
+		var err error
+		if thresholds, err = local.ReadThresholdFile(file); err != nil {
+			return nil, err
+		}
+	}
+	if threshold != "" {
+		th, err := local.ParseThreshold(threshold)
+		if err != nil {
+			return nil, err
+		}
+		thresholds.SetDefault(th)
+	}
+	return thresholds, nil
+}
+
+// compareFiles shows the results in the JSON files side by side and returns
+// an error if any metric regressed beyond its threshold
+func compareFiles(args []string, thresholds *local.Thresholds) error {
 	if len(args) == 0 {
 		return fmt.Errorf("missing files to compare")
 	}
@@ -65,6 +107,26 @@ func compare(_ *cobra.Command, args []string) error {
 		summaries = append(summaries, s)
 	}
 
+	var regressions []string
+	// metricChanges returns the change of metric name of test in file
+	// relative to base, and records it if it regressed beyond its threshold.
+	// Metrics without a direction can only regress if the threshold file
+	// has a threshold for them, and then any change beyond it counts.
+	metricChanges := func(test, name, file string, base, m local.Metric) string {
+		var changes []string
+		if change, ok := m.Change(base); ok {
+			changes = append(changes, fmt.Sprintf("%+.1f%%", change))
+		}
+		if th, ok := thresholds.Lookup(test, name); ok {
+			c := local.CompareMetric(base, m, th)
+			changes = append(changes, local.MetricChangeNames[c])
+			if c == local.Regressed || c == local.Changed && thresholds.Listed(test, name) {
+				regressions = append(regressions, fmt.Sprintf("%s %s in %s: %s -> %s (threshold %g%%)", test, name, file, base, m, th))
+			}
+		}
+		return strings.Join(changes, ", ")
+	}
+
 	tw := new(tabwriter.Writer)
 	tw.Init(os.Stdout, 0, 8, 0, '\t', 0)
 
@@ -94,6 +156,14 @@ func compare(_ *cobra.Command, args []string) error {
 		}
 	}
 
+	writeRow := func(row []string) error {
+		if !csvCompare {
+			_, _ = fmt.Fprintln(tw, strings.Join(row, "\t"))
+			return nil
+		}
+		return cw.Write(row)
+	}
+
 	for i := range summaries[0].Results {
 		name := summaries[0].Results[i].Name
 		results := []string{name}
@@ -103,22 +173,185 @@ func compare(_ *cobra.Command, args []string) error {
 				return fmt.Errorf("list of results for %s don't match %s: %s != %s", args[0], args[j], r.Name, name)
 			}
 
-			resStr := r.TestResult.Sprintf("%s (%s)",
-				local.TestResultNames[r.TestResult], fmt.Sprintf("%.2fs", r.Duration.Seconds()))
+			details := fmt.Sprintf("%.2fs", r.Duration.Seconds())
+			if r.Attempts > 1 {
+				details = fmt.Sprintf("%s, %d attempts", details, r.Attempts)
+			}
+			if r.Reason != "" {
+				details = fmt.Sprintf("%s, %s", details, r.Reason)
+			}
+			if len(r.Artifacts) > 0 {
+				details = fmt.Sprintf("%s, %d artifacts", details, len(r.Artifacts))
+			}
+			if len(r.Warnings) > 0 {
+				details = fmt.Sprintf("%s, %d warnings", details, len(r.Warnings))
+			}
+			if len(r.Notes) > 0 {
+				details = fmt.Sprintf("%s, %d notes", details, len(r.Notes))
+			}
+			if len(r.Links) > 0 {
+				details = fmt.Sprintf("%s, %d links", details, len(r.Links))
+			}
+			resStr := r.TestResult.Sprintf("%s (%s)", local.TestResultNames[r.TestResult], details)
 			if r.TestResult == local.Pass && r.BenchmarkResult != "" {
 				resStr = r.BenchmarkResult
+				base, hasBase := local.BenchmarkMetric(summaries[0].Results[i])
+				if m, ok := local.BenchmarkMetric(r); ok && j > 0 && hasBase {
+					if changes := metricChanges(name, local.BenchmarkMetricName, args[j], base, m); changes != "" {
+						resStr = fmt.Sprintf("%s (%s)", resStr, changes)
+					}
+				}
 			}
 			results = append(results, resStr)
 		}
-		if !csvCompare {
-			_, _ = fmt.Fprintln(tw, strings.Join(results, "\t"))
-		} else {
-			if err := cw.Write(results); err != nil {
+		if err := writeRow(results); err != nil {
+			return err
+		}
+
+		var rows [][]string
+		for _, m := range metricNames(summaries, i) {
+			row := []string{fmt.Sprintf("  %s %s", name, m)}
+			base, hasBase := summaries[0].Results[i].Metrics[m]
+			for j := range summaries {
+				v := "-"
+				if metric, ok := summaries[j].Results[i].Metrics[m]; ok {
+					v = metric.String()
+					if j > 0 && hasBase {
+						if changes := metricChanges(name, m, args[j], base, metric); changes != "" {
+							v = fmt.Sprintf("%s (%s)", v, changes)
+						}
+					}
+				}
+				row = append(row, v)
+			}
+			rows = append(rows, row)
+		}
+		if compareSteps {
+			for _, st := range stepNames(summaries, i) {
+				row := []string{fmt.Sprintf("  %s step %s", name, st)}
+				base, hasBase := stepDuration(summaries[0].Results[i], st)
+				for j := range summaries {
+					v := "-"
+					if d, ok := stepDuration(summaries[j].Results[i], st); ok {
+						v = fmt.Sprintf("%.2fs", d.Seconds())
+						if j > 0 && hasBase {
+							if change, ok := (local.Metric{Value: d.Seconds()}).Change(local.Metric{Value: base.Seconds()}); ok {
+								v = fmt.Sprintf("%s (%+.1f%%)", v, change)
+							}
+						}
+					}
+					row = append(row, v)
+				}
+				rows = append(rows, row)
+			}
+		}
+		for _, sr := range subResultNames(summaries, i) {
+			row := []string{fmt.Sprintf("  %s/%s", name, sr)}
+			for j := range summaries {
+				v := "-"
+				for _, r := range summaries[j].Results[i].SubResults {
+					if r.Name == sr {
+						v = r.TestResult.Sprintf("%s", local.TestResultNames[r.TestResult])
+					}
+				}
+				row = append(row, v)
+			}
+			rows = append(rows, row)
+		}
+		for _, row := range rows {
+			if err := writeRow(row); err != nil {
 				return err
 			}
 		}
 	}
 	_ = tw.Flush()
 	cw.Flush()
+
+	if compareArtifacts && !csvCompare {
+		printArtifacts(args, summaries)
+	}
+	if len(regressions) > 0 {
+		return fmt.Errorf("%d metrics regressed beyond their threshold:\n  %s", len(regressions), strings.Join(regressions, "\n  "))
+	}
 	return nil
 }
+
+// metricNames returns the sorted names of the metrics reported by the i-th
+// result of any of the summaries
+func metricNames(summaries []local.Summary, i int) []string {
+	seen := map[string]bool{}
+	var names []string
+	for _, s := range summaries {
+		for m := range s.Results[i].Metrics {
+			if !seen[m] {
+				seen[m] = true
+				names = append(names, m)
+			}
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// subResultNames returns the names of the sub-results of the i-th result of
+// any of the summaries, in the order they were reported in
+func subResultNames(summaries []local.Summary, i int) []string {
+	seen := map[string]bool{}
+	var names []string
+	for _, s := range summaries {
+		for _, r := range s.Results[i].SubResults {
+			if !seen[r.Name] {
+				seen[r.Name] = true
+				names = append(names, r.Name)
+			}
+		}
+	}
+	return names
+}
+
+// stepNames returns the names of the steps of the i-th result of any of the
+// summaries, in the order they began in
+func stepNames(summaries []local.Summary, i int) []string {
+	seen := map[string]bool{}
+	var names []string
+	for _, s := range summaries {
+		for _, st := range s.Results[i].Steps {
+			if !seen[st.Name] {
+				seen[st.Name] = true
+				names = append(names, st.Name)
+			}
+		}
+	}
+	return names
+}
+
+// stepDuration returns the total duration of the steps called name of a
+// result, as a step may be run several times
+func stepDuration(r local.Result, name string) (time.Duration, bool) {
+	var d time.Duration
+	found := false
+	for _, st := range r.Steps {
+		if st.Name == name {
+			d += st.Duration
+			found = true
+		}
+	}
+	return d, found
+}
+
+// printArtifacts lists the artifacts of each result. Artifact paths are
+// relative to the result directory, which also contains the JSON file.
+func printArtifacts(fileNames []string, summaries []local.Summary) {
+	tw := new(tabwriter.Writer)
+	tw.Init(os.Stdout, 0, 8, 1, '\t', 0)
+	_, _ = fmt.Fprintln(tw, "\nName\tArtifact\tSize\tSHA256")
+	for i, s := range summaries {
+		dir := filepath.Dir(fileNames[i])
+		for _, r := range s.Results {
+			for _, a := range r.Artifacts {
+				_, _ = fmt.Fprintf(tw, "%s\t%s\t%d\t%s\n", r.Name, filepath.Join(dir, filepath.FromSlash(a.Path)), a.Size, a.SHA256)
+			}
+		}
+	}
+	_ = tw.Flush()
+}
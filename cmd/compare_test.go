@@ -0,0 +1,59 @@
+package cmd
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/linuxkit/rtf/local"
+)
+
+func TestCompareBenchmarkThreshold(t *testing.T) {
+	dir, err := ioutil.TempDir("", "rtf")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = os.RemoveAll(dir) }()
+
+	// Summaries with only the RT_BENCHMARK_RESULT of a test and no metrics
+	var files []string
+	for _, bm := range []string{"100", "105", "200"} {
+		s := local.Summary{ID: bm, Results: []local.Result{{Name: "foo.bench", TestResult: local.Pass, BenchmarkResult: bm}}}
+		data, err := json.Marshal(s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		f := filepath.Join(dir, bm+".json")
+		if err := ioutil.WriteFile(f, data, 0644); err != nil {
+			t.Fatal(err)
+		}
+		files = append(files, f)
+	}
+
+	thresholds, err := readThresholds("10%", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := compareFiles(files[:2], thresholds); err != nil {
+		t.Fatalf("Expected a change within the threshold to pass, got %v", err)
+	}
+	// Without a direction the change is only reported
+	if err := compareFiles([]string{files[0], files[2]}, thresholds); err != nil {
+		t.Fatalf("Expected a change of a benchmark result without a threshold in the file to pass, got %v", err)
+	}
+
+	thresholdFile := filepath.Join(dir, "thresholds")
+	if err := ioutil.WriteFile(thresholdFile, []byte("foo.bench benchmark 10%\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if thresholds, err = readThresholds("", thresholdFile); err != nil {
+		t.Fatal(err)
+	}
+	err = compareFiles([]string{files[0], files[2]}, thresholds)
+	if err == nil || !strings.Contains(err.Error(), "foo.bench benchmark") {
+		t.Fatalf("Expected the benchmark result to regress, got %v", err)
+	}
+}
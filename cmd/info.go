@@ -54,9 +54,9 @@ func info(_ *cobra.Command, _ []string) error {
 
 	lst := p.List(config)
 	if !csvInfo {
-		_, _ = fmt.Fprintf(tw, "NAME\tDESCRIPTION\n")
+		_, _ = fmt.Fprintf(tw, "NAME\tREPEAT\tDESCRIPTION\n")
 	} else {
-		heading := []string{"Name", "Description", "Known issues"}
+		heading := []string{"Name", "Repeat", "Description", "Known issues"}
 		if err := cw.Write(heading); err != nil {
 			return nil
 		}
@@ -64,9 +64,9 @@ func info(_ *cobra.Command, _ []string) error {
 
 	for _, i := range lst {
 		if !csvInfo {
-			_, _ = fmt.Fprintf(tw, "%s\t%s\n", i.Name, i.Summary)
+			_, _ = fmt.Fprintf(tw, "%s\t%s\t%s\n", i.Name, i.RepeatString(), i.Summary)
 		} else {
-			out := []string{i.Name, i.Summary, i.Issue}
+			out := []string{i.Name, i.RepeatString(), i.Summary, i.Issue}
 			if err := cw.Write(out); err != nil {
 				return nil
 			}
@@ -63,10 +63,10 @@ func list(_ *cobra.Command, args []string) error {
 	w.Init(os.Stdout, 0, 8, 0, '\t', 0)
 
 	lst := p.List(config)
-	_, _ = fmt.Fprint(w, "STATE\tTEST\tLABELS\n")
+	_, _ = fmt.Fprint(w, "STATE\tTEST\tREPEAT\tLABELS\n")
 	for _, i := range lst {
 		state := i.TestResult.Sprintf(local.TestResultNames[i.TestResult])
-		_, _ = fmt.Fprintf(w, "%s\t%s\t%s\n", state, i.Name, i.LabelString())
+		_, _ = fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", state, i.Name, i.RepeatString(), i.LabelString())
 	}
 	_ = w.Flush()
 	return nil
@@ -18,14 +18,17 @@ import (
 	"fmt"
 	"os"
 
+	"github.com/linuxkit/rtf/local"
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
 )
 
 var (
-	caseDir string
-	labels  string
-	verbose int
+	caseDir  string
+	labels   string
+	verbose  int
+	envVars  []string
+	envFiles []string
 )
 
 // RootCmd represents the base command when called without any subcommands
@@ -40,7 +43,7 @@ var RootCmd = &cobra.Command{
 // This is called by main.main(). It only needs to happen once to the rootCmd.
 func Execute() {
 	if err := RootCmd.Execute(); err != nil {
-		fmt.Println(err)
+		fmt.Fprintln(os.Stderr, err)
 		os.Exit(1)
 	}
 }
@@ -52,9 +55,29 @@ func init() {
 	flags.StringVarP(&caseDir, "casedir", "c", "cases", "Directory containing cases")
 	flags.StringVarP(&labels, "labels", "l", "", "Labels to apply (comma separated)")
 	flags.CountVarP(&verbose, "verbose", "v", "Increase verbosity level")
+	flags.StringArrayVarP(&envVars, "env", "e", nil, "Set an environment variable for tests in the form KEY=VALUE (can be repeated)")
+	flags.StringArrayVarP(&envFiles, "env-file", "", nil, "Read environment variables for tests from a file with one KEY=VALUE per line (can be repeated)")
 }
 
 // initConfig reads in config file and ENV variables if set.
 func initConfig() {
 	viper.AutomaticEnv() // read in environment variables that match
 }
+
+// testEnv returns the environment variables for tests from the command line.
+// Variables from --env take precedence over the ones from --env-file.
+func testEnv() ([]string, error) {
+	var env []string
+	for _, f := range envFiles {
+		vars, err := local.ReadEnvFile(f)
+		if err != nil {
+			return nil, err
+		}
+		env = append(env, vars...)
+	}
+	vars, err := local.ParseEnv(envVars)
+	if err != nil {
+		return nil, err
+	}
+	return append(env, vars...), nil
+}
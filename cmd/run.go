@@ -18,11 +18,16 @@ import (
 	"encoding/csv"
 	"encoding/json"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"os"
+	"os/signal"
 	"path/filepath"
+	"runtime"
+	"sort"
 	"strconv"
 	"strings"
+	"syscall"
 	"time"
 
 	"github.com/docker/distribution/uuid"
@@ -36,8 +41,14 @@ const (
 	summaryJSONName = "SUMMARY.json"
 	testsCsvName    = "TESTS.csv"
 	summaryCsvName  = "SUMMARY.csv"
+	junitName       = "junit.xml"
 	testsLogName    = "TESTS.log"
 	latestResults   = "latest"
+
+	// formatConsole logs the results of tests for humans to stderr
+	formatConsole = "console"
+	// formatTAP also writes the results as a TAP stream to stdout
+	formatTAP = "tap"
 )
 
 var (
@@ -67,6 +78,24 @@ var (
 		"Benchmark",
 		"Description",
 		"Issues",
+		"Attempts",
+		"Resource Wait",
+		"Exit Code",
+		"Signal",
+		"User Time",
+		"System Time",
+		"Max RSS",
+		"Minor Faults",
+		"Major Faults",
+		"Voluntary Context Switches",
+		"Involuntary Context Switches",
+		"Reason",
+		"Metrics",
+		"Warnings",
+		"Sub-results",
+		"Steps",
+		"Notes",
+		"Links",
 	}
 )
 
@@ -76,7 +105,18 @@ var (
 	symlink      bool
 	extra        bool
 	parallel     bool
+	jobs         int
 	shardPattern string
+	timeout      time.Duration
+	gracePeriod  time.Duration
+	retries      int
+	failFast     bool
+	maxFailures  int
+	keepTmp      string
+	cgroups      bool
+	sandbox      bool
+	junit        bool
+	format       string
 )
 
 var runCmd = &cobra.Command{
@@ -90,7 +130,18 @@ func init() {
 	flags.StringVarP(&resultDir, "resultdir", "r", "_results", "Directory to place results in")
 	flags.StringVarP(&id, "id", "", "", "ID for this test run")
 	flags.BoolVarP(&extra, "extra", "x", false, "Add extra debug info to log files")
-	flags.BoolVarP(&parallel, "parallel", "p", false, "Run multiple tests in parallel")
+	flags.IntVarP(&jobs, "jobs", "p", 1, "Number of tests to run in parallel, 0 means one per CPU")
+	flags.BoolVarP(&parallel, "parallel", "", false, "Run tests in parallel with one per CPU, same as --jobs=0")
+	flags.DurationVarP(&timeout, "timeout", "", 0, "Default timeout for each test, overridden by a test's TIMEOUT tag (0 means no timeout)")
+	flags.IntVarP(&retries, "retries", "", 0, "Default number of times a failed test is retried, overridden by a test's RETRIES tag")
+	flags.BoolVarP(&failFast, "fail-fast", "", false, "Stop starting new tests after the first failure, same as --max-failures 1")
+	flags.IntVarP(&maxFailures, "max-failures", "", 0, "Stop starting new tests after this many failures (0 means no limit)")
+	flags.StringVarP(&keepTmp, "keep-tmp", "", "on-failure", "When to keep the scratch directory of a test in the result directory: always, never or on-failure")
+	flags.BoolVarP(&cgroups, "cgroups", "", false, "Run each test in its own cgroup v2 to account for all its processes and apply MEMORY_LIMIT and CPU_LIMIT (Linux only)")
+	flags.BoolVarP(&sandbox, "sandbox", "", false, "Run each test in new user, mount and PID namespaces with a private /tmp and a read-only case directory (Linux only)")
+	flags.BoolVarP(&junit, "junit", "", false, "Also write the results as a JUnit XML report, "+junitName+", to the result directory")
+	flags.StringVarP(&format, "format", "", formatConsole, "Output format: console, or tap for a TAP version 14 stream of the results on stdout")
+	flags.DurationVarP(&gracePeriod, "grace-period", "", 10*time.Second, "Time running tests are given to exit after the run is interrupted before they are killed")
 	// shardPattern is 1-based (1/10, 3/10, 10/10) rather than normal computer 0-based (0/9, 2/9, 9/9), because it is easier for
 	// humans to understand when calling the CLI.
 	flags.StringVarP(&shardPattern, "shard", "s", "", "which shard to run, in form of 'N/M' where N is the shard number and M is the total number of shards, smallest shard number is 1. Shards are applied only to tests that would run, not those that would be skipped.")
@@ -108,7 +159,44 @@ func run(cmd *cobra.Command, args []string) error {
 	}
 	runConfig := local.NewRunConfig(labels, pattern)
 	runConfig.Extra = extra
-	runConfig.Parallel = parallel
+	if jobs < 0 {
+		return fmt.Errorf("invalid number of jobs: %d", jobs)
+	}
+	if jobs == 0 || parallel {
+		jobs = runtime.NumCPU()
+	}
+	runConfig.Jobs = jobs
+	runConfig.Timeout = timeout
+	if retries < 0 {
+		return fmt.Errorf("invalid number of retries: %d", retries)
+	}
+	runConfig.Retries = retries
+	if runConfig.Env, err = testEnv(); err != nil {
+		return err
+	}
+	if maxFailures < 0 {
+		return fmt.Errorf("invalid maximum number of failures: %d", maxFailures)
+	}
+	if failFast {
+		maxFailures = 1
+	}
+	if maxFailures > 0 {
+		runConfig.FailureLimit = local.NewFailureLimit(maxFailures)
+	}
+	if runConfig.KeepTmp, err = local.ParseKeepTmp(keepTmp); err != nil {
+		return fmt.Errorf("--keep-tmp: %v", err)
+	}
+	// In TAP mode stdout only carries the TAP stream
+	out := io.Writer(os.Stdout)
+	var tapLogger *logger.TAPLogger
+	switch format {
+	case formatConsole:
+	case formatTAP:
+		out = os.Stderr
+		tapLogger = logger.NewTAPLogger(os.Stdout)
+	default:
+		return fmt.Errorf("invalid format %q, expected %s or %s", format, formatConsole, formatTAP)
+	}
 
 	p, err := local.InitNewProject(caseDir)
 	if err != nil {
@@ -127,14 +215,14 @@ func run(cmd *cobra.Command, args []string) error {
 	for k := range runConfig.NotLabels {
 		labelList = append(labelList, "!"+k)
 	}
-	fmt.Printf("LABELS: %s\n", strings.Join(labelList, ", "))
+	fmt.Fprintf(out, "LABELS: %s\n", strings.Join(labelList, ", "))
 
 	if id == "" {
 		symlink = true
 		id = uuid.Generate().String()
 	}
 
-	fmt.Printf("ID: %s\n", id)
+	fmt.Fprintf(out, "ID: %s\n", id)
 	baseDir, err := setupResultsDirectory(id, symlink)
 	if err != nil {
 		return err
@@ -183,12 +271,21 @@ func run(cmd *cobra.Command, args []string) error {
 	case 3:
 		consoleLogger.SetLevel(logger.LevelDebug)
 	default:
-		consoleLogger.SetLevel(logger.LevelSummary)
+		if tapLogger != nil {
+			// The results are in the TAP stream
+			consoleLogger.SetLevel(logger.LevelWarning)
+		} else {
+			consoleLogger.SetLevel(logger.LevelSummary)
+		}
 	}
 	testsLogger.SetLevel(logger.LevelDebug)
-	log := logger.NewLogDispatcher(map[string]logger.Logger{testsLogName: testsLogger, "Console": consoleLogger})
+	backends := map[string]logger.Logger{testsLogName: testsLogger, "Console": consoleLogger}
+	if tapLogger != nil {
+		backends["TAP"] = tapLogger
+	}
+	log := logger.NewLogDispatcher(backends)
 
-	var passed, failed, skipped, cancelled int
+	var passed, failed, skipped, cancelled, timedOut, flaky int
 	startTime := time.Now()
 	runConfig.Logger = log
 	runConfig.LogDir = baseDir
@@ -203,9 +300,57 @@ func run(cmd *cobra.Command, args []string) error {
 		StartTime:  startTime,
 	}
 
+	interrupt := local.NewInterrupt(gracePeriod)
+	runConfig.Interrupt = interrupt
+	sigCh := make(chan os.Signal, 1)
+	signal.Notify(sigCh, os.Interrupt, syscall.SIGTERM)
+	defer signal.Stop(sigCh)
+	go func() {
+		for sig := range sigCh {
+			log.Log(logger.LevelWarning, fmt.Sprintf("Received %s, cancelling tests", sig))
+			interrupt.Signal(sig)
+		}
+	}()
+
+	if cgroups {
+		c, err := local.NewCgroups()
+		if err != nil {
+			log.Log(logger.LevelWarning, fmt.Sprintf("Per-test cgroups are not available, running tests without them: %v", err))
+		} else {
+			ctrls := strings.Join(c.Controllers(), ", ")
+			if ctrls == "" {
+				ctrls = "none"
+			}
+			log.Log(logger.LevelInfo, fmt.Sprintf("Running tests in their own cgroups, controllers available for limits: %s", ctrls))
+			runConfig.Cgroups = c
+			defer func() {
+				if err := c.Close(); err != nil {
+					log.Log(logger.LevelWarning, fmt.Sprintf("Failed to clean up cgroups: %v", err))
+				}
+			}()
+		}
+	}
+
+	if sandbox {
+		if err := local.CheckSandbox(runConfig); err != nil {
+			return fmt.Errorf("the sandbox is not available: %v", err)
+		}
+		runConfig.Sandbox = true
+	}
+
 	res, err := p.Run(runConfig)
+	summary.Interrupted = interrupt.Interrupted()
+	// Only removed if all scratch directories were cleaned up or kept
+	_ = os.Remove(filepath.Join(baseDir, local.ScratchDirName))
 	if err != nil {
-		return err
+		if !summary.Interrupted {
+			if tapLogger != nil {
+				tapLogger.BailOut(err.Error())
+			}
+			return err
+		}
+		// Still write out the results for the tests which did run
+		log.Log(logger.LevelError, err.Error())
 	}
 
 	for _, r := range res {
@@ -222,6 +367,10 @@ func run(cmd *cobra.Command, args []string) error {
 			skipped++
 		case local.Cancel:
 			cancelled++
+		case local.Timeout:
+			timedOut++
+		case local.Flaky:
+			flaky++
 		}
 		var testSummary, issue string
 		if r.Test != nil {
@@ -238,7 +387,25 @@ func run(cmd *cobra.Command, args []string) error {
 			r.BenchmarkResult,
 			testSummary,
 			issue,
+			strconv.Itoa(r.Attempts),
+			strconv.FormatFloat(r.ResourceWait.Seconds(), 'f', -1, 32),
+			strconv.Itoa(r.ExitCode),
+			r.Signal,
+		}
+		if u := r.Usage; u != nil {
+			testResult = append(testResult,
+				strconv.FormatFloat(u.UserTime.Seconds(), 'f', -1, 32),
+				strconv.FormatFloat(u.SystemTime.Seconds(), 'f', -1, 32),
+				strconv.FormatInt(u.MaxRSS, 10),
+				strconv.FormatInt(u.MinorFaults, 10),
+				strconv.FormatInt(u.MajorFaults, 10),
+				strconv.FormatInt(u.VoluntaryContextSwitches, 10),
+				strconv.FormatInt(u.InvoluntaryContextSwitches, 10),
+			)
+		} else {
+			testResult = append(testResult, "", "", "", "", "", "", "")
 		}
+		testResult = append(testResult, r.Reason, metricsString(r.Metrics), strings.Join(r.Warnings, "; "), subResultsString(r.SubResults), stepsString(r.Steps), strings.Join(r.Notes, "; "), linksString(r.Links))
 		if err = tCsv.Write(testResult); err != nil {
 			return err
 		}
@@ -254,6 +421,11 @@ func run(cmd *cobra.Command, args []string) error {
 	if err = ioutil.WriteFile(summaryJSONPath, summaryJSON, 0644); err != nil {
 		return err
 	}
+	if junit {
+		if err := writeJUnit(filepath.Join(baseDir, junitName), summary, baseDir); err != nil {
+			return err
+		}
+	}
 
 	summaryCSV := []string{
 		id,
@@ -261,8 +433,9 @@ func run(cmd *cobra.Command, args []string) error {
 		startTime.Format(time.RFC3339),
 		endTime.Format(time.RFC3339),
 		strconv.FormatFloat(duration.Seconds(), 'f', -1, 32),
-		strconv.Itoa(passed),
-		strconv.Itoa(failed),
+		// Flaky tests did pass in the end and timed out ones failed
+		strconv.Itoa(passed + flaky),
+		strconv.Itoa(failed + timedOut),
 		strconv.Itoa(skipped),
 		"",
 		systemInfo.OS,
@@ -283,11 +456,19 @@ func run(cmd *cobra.Command, args []string) error {
 	log.Log(logger.LevelSummary, fmt.Sprintf("Version: %s", systemInfo.Version))
 	log.Log(logger.LevelSummary, fmt.Sprintf("Passed: %d", passed))
 	log.Log(logger.LevelSummary, fmt.Sprintf("Failed: %d", failed))
+	log.Log(logger.LevelSummary, fmt.Sprintf("Flaky: %d", flaky))
 	log.Log(logger.LevelSummary, fmt.Sprintf("Cancelled: %d", cancelled))
+	log.Log(logger.LevelSummary, fmt.Sprintf("Timed out: %d", timedOut))
 	log.Log(logger.LevelSummary, fmt.Sprintf("Skipped: %d", skipped))
 	log.Log(logger.LevelSummary, fmt.Sprintf("Duration: %.2fs", duration.Seconds()))
+	if tapLogger != nil {
+		tapLogger.End()
+	}
 
-	if failed > 0 {
+	if summary.Interrupted {
+		return fmt.Errorf("test run interrupted")
+	}
+	if failed > 0 || timedOut > 0 {
 		return fmt.Errorf("some tests failed")
 	}
 	return nil
@@ -342,3 +523,71 @@ func parseShardPattern(pattern string) (shard int, total int, err error) {
 	}
 	return shard, total, nil
 }
+
+// metricsString returns the metrics as "name=value unit" pairs separated by
+// semicolons, sorted by name
+func metricsString(metrics map[string]local.Metric) string {
+	var names []string
+	for m := range metrics {
+		names = append(names, m)
+	}
+	sort.Strings(names)
+	var parts []string
+	for _, m := range names {
+		parts = append(parts, fmt.Sprintf("%s=%s", m, metrics[m]))
+	}
+	return strings.Join(parts, "; ")
+}
+
+// writeJUnit writes the JUnit XML report of the run to path
+func writeJUnit(path string, summary local.Summary, logDir string) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if err := local.WriteJUnit(f, summary, logDir); err != nil {
+		_ = f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// stepsString returns the steps as "name=duration" pairs separated by
+// semicolons, in the order they began in
+func stepsString(steps []local.Step) string {
+	var parts []string
+	for _, st := range steps {
+		parts = append(parts, fmt.Sprintf("%s=%.3fs", st.Name, st.Duration.Seconds()))
+	}
+	return strings.Join(parts, "; ")
+}
+
+// linksString returns the links as "name=url" pairs, or just the URL of links
+// without a name, separated by semicolons
+func linksString(links []local.Link) string {
+	var parts []string
+	for _, l := range links {
+		if l.Name != "" {
+			parts = append(parts, fmt.Sprintf("%s=%s", l.Name, l.URL))
+		} else {
+			parts = append(parts, l.URL)
+		}
+	}
+	return strings.Join(parts, "; ")
+}
+
+// subResultsString returns the number of sub-results by result, e.g.
+// "Pass: 3; Fail: 1"
+func subResultsString(subResults []local.SubResult) string {
+	counts := map[local.TestResult]int{}
+	for _, r := range subResults {
+		counts[r.TestResult]++
+	}
+	var parts []string
+	for _, res := range []local.TestResult{local.Pass, local.Fail, local.Skip, local.Cancel, local.Timeout, local.Flaky} {
+		if counts[res] > 0 {
+			parts = append(parts, fmt.Sprintf("%s: %d", local.TestResultNames[res], counts[res]))
+		}
+	}
+	return strings.Join(parts, "; ")
+}
@@ -5,4 +5,8 @@
 # Special return code to indicate that a test was cancelled
 RT_TEST_CANCEL=253
 
+# Special return code to indicate that a test was skipped, e.g. because
+# one of its preconditions is not met
+RT_TEST_SKIP=254
+
 # TODO: needs expanding
@@ -5,6 +5,10 @@
 # Special return code to indicate that a test was cancelled
 RT_TEST_CANCEL=253
 
+# Special return code to indicate that a test was skipped, e.g. because
+# one of its preconditions is not met
+RT_TEST_SKIP=254
+
 # Echo to stderr
 echoerr() {
     echo "$@" 1>&2
@@ -33,6 +37,62 @@ rt_label_set() {
     return $res
 }
 
+# Skip the test with a reason and exit
+# Usage: rt_skip "reason"
+rt_skip() {
+    echo "RT_SKIP_REASON: $1"
+    exit $RT_TEST_SKIP
+}
+
+# Escape a string for use in a JSON string
+rt_json_escape() {
+    printf '%s' "$1" | sed -e 's/\\/\\\\/g' -e 's/"/\\"/g' | tr '\n\t' '  '
+}
+
+# Report a metric in the result file
+# Usage: rt_metric name value [unit] [higher-is-better|lower-is-better]
+rt_metric() {
+    printf '{"type":"metric","name":"%s","value":%s,"unit":"%s","direction":"%s"}\n' \
+        "$(rt_json_escape "$1")" "$2" "$(rt_json_escape "$3")" "$4" >> "$RT_RESULT_FILE"
+}
+
+# Report a note or a warning in the result file
+# Usage: rt_note "text", rt_warning "text"
+rt_note() {
+    printf '{"type":"note","text":"%s"}\n' "$(rt_json_escape "$1")" >> "$RT_RESULT_FILE"
+}
+rt_warning() {
+    printf '{"type":"warning","text":"%s"}\n' "$(rt_json_escape "$1")" >> "$RT_RESULT_FILE"
+}
+
+# Report the result of a part of the test in the result file
+# Usage: rt_subresult name pass|fail|skip [duration in seconds]
+rt_subresult() {
+    printf '{"type":"result","name":"%s","result":"%s","duration":%s}\n' \
+        "$(rt_json_escape "$1")" "$2" "${3:-0}" >> "$RT_RESULT_FILE"
+}
+
+# Mark the beginning and the end of a timed step of the test
+# Usage: rt_step_begin name, rt_step_end name
+rt_step_begin() {
+    echo "RT_STEP_BEGIN: $1"
+}
+rt_step_end() {
+    echo "RT_STEP_END: $1"
+}
+
+# Run a command as a timed step of the test and return its exit code
+# Usage: rt_step name command [args...]
+rt_step() {
+    _rt_step_name="$1"
+    shift
+    rt_step_begin "$_rt_step_name"
+    _rt_step_rc=0
+    "$@" || _rt_step_rc=$?
+    rt_step_end "$_rt_step_name"
+    return $_rt_step_rc
+}
+
 # Usage: command | assert_contains "pattern"
 assert_contains() {
     STDIN=$(cat)
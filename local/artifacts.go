@@ -0,0 +1,89 @@
+package local
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// artifactsDirName is the name of the directory, below the directory named
+// after a test in the result directory, where a test stores its artifacts
+const artifactsDirName = "artifacts"
+
+// Artifact is a file a test stored in its artifacts directory
+type Artifact struct {
+	// Path is relative to the result directory and uses forward slashes
+	Path   string `json:"path"`
+	Size   int64  `json:"size"`
+	SHA256 string `json:"sha256"`
+}
+
+// artifactsDir returns the artifacts directory of the test run name
+func artifactsDir(name string, config RunConfig) string {
+	return filepath.Join(config.LogDir, name, artifactsDirName)
+}
+
+// keepAttemptArtifacts moves the artifacts of an attempt of a test which is
+// retried out of the way of the next attempt, to <name>/artifacts.attemptN
+func keepAttemptArtifacts(name string, attempt int, config RunConfig) error {
+	dir := artifactsDir(name, config)
+	if _, err := os.Stat(dir); os.IsNotExist(err) {
+		return nil
+	}
+	return os.Rename(dir, fmt.Sprintf("%s.attempt%d", dir, attempt))
+}
+
+// collectArtifacts returns the files in the artifacts directory dir, with
+// paths relative to root. Empty directories are removed, so that tests which
+// do not store any artifacts do not leave directories behind.
+func collectArtifacts(dir, root string) ([]Artifact, error) {
+	var artifacts []Artifact
+	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if !info.Mode().IsRegular() {
+			return nil
+		}
+		sum, err := sha256File(path)
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(root, path)
+		if err != nil {
+			return err
+		}
+		artifacts = append(artifacts, Artifact{
+			Path:   filepath.ToSlash(rel),
+			Size:   info.Size(),
+			SHA256: sum,
+		})
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if len(artifacts) == 0 {
+		// Only removes the directories if they are empty
+		_ = os.Remove(dir)
+		_ = os.Remove(filepath.Dir(dir))
+	}
+	return artifacts, nil
+}
+
+// sha256File returns the hex encoded SHA256 checksum of a file
+func sha256File(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer func() { _ = f.Close() }()
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
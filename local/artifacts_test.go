@@ -0,0 +1,84 @@
+package local
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestCollectArtifacts(t *testing.T) {
+	root, err := ioutil.TempDir("", "rtf")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = os.RemoveAll(root) }()
+	config := RunConfig{LogDir: root}
+
+	dir := artifactsDir("foo.bar", config)
+	if err := os.MkdirAll(filepath.Join(dir, "sub"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, "sub", "core"), []byte("hello\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	artifacts, err := collectArtifacts(dir, root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	exp := []Artifact{{
+		Path:   "foo.bar/artifacts/sub/core",
+		Size:   6,
+		SHA256: "5891b5b522d5df086d0ff0b110fbd9d21bb4fc7163af34d08286a2e846f6be03",
+	}}
+	if !reflect.DeepEqual(artifacts, exp) {
+		t.Fatalf("Expected %v, got %v", exp, artifacts)
+	}
+
+	// Empty artifact directories are removed
+	empty := artifactsDir("foo.baz", config)
+	if err := os.MkdirAll(empty, 0755); err != nil {
+		t.Fatal(err)
+	}
+	artifacts, err = collectArtifacts(empty, root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(artifacts) != 0 {
+		t.Fatalf("Expected no artifacts, got %v", artifacts)
+	}
+	if _, err := os.Stat(filepath.Join(root, "foo.baz")); !os.IsNotExist(err) {
+		t.Fatalf("Expected empty artifacts directory to be removed")
+	}
+}
+
+func TestKeepAttemptArtifacts(t *testing.T) {
+	root, err := ioutil.TempDir("", "rtf")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = os.RemoveAll(root) }()
+	config := RunConfig{LogDir: root}
+
+	// Nothing to keep if the attempt did not store any artifacts
+	if err := keepAttemptArtifacts("foo.bar", 1, config); err != nil {
+		t.Fatal(err)
+	}
+	dir := artifactsDir("foo.bar", config)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, "core"), []byte("hello\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := keepAttemptArtifacts("foo.bar", 2, config); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(dir); !os.IsNotExist(err) {
+		t.Fatalf("Expected the artifacts directory to be moved")
+	}
+	if _, err := os.Stat(filepath.Join(root, "foo.bar", "artifacts.attempt2", "core")); err != nil {
+		t.Fatal(err)
+	}
+}
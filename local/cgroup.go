@@ -0,0 +1,76 @@
+package local
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// CgroupUsage is the resource usage of all processes which ran in the cgroup
+// of a test, including any which were not waited for
+type CgroupUsage struct {
+	// MemoryPeak is the peak memory usage in bytes, if the memory
+	// controller is available
+	MemoryPeak int64         `json:"memory_peak,omitempty"`
+	CPUUsage   time.Duration `json:"cpu_usage"`
+	UserTime   time.Duration `json:"user_time"`
+	SystemTime time.Duration `json:"system_time"`
+	OOMKills   int64         `json:"oom_kills,omitempty"`
+	// Killed is the number of processes left behind by the test which
+	// were killed after it finished
+	Killed int `json:"killed,omitempty"`
+}
+
+// String returns a human readable summary of the cgroup usage
+func (u *CgroupUsage) String() string {
+	return fmt.Sprintf("cpu %.2fs (user %.2fs, system %.2fs), peak memory %d KB, OOM kills %d, processes killed %d",
+		u.CPUUsage.Seconds(), u.UserTime.Seconds(), u.SystemTime.Seconds(), u.MemoryPeak/1024, u.OOMKills, u.Killed)
+}
+
+// resourceLimits are the limits applied to the cgroup of a test. Zero values
+// mean no limit.
+type resourceLimits struct {
+	// memory is the memory limit in bytes
+	memory int64
+	// cpu is the number of CPUs the test may use
+	cpu float64
+}
+
+// set returns true if any limit is set
+func (l resourceLimits) set() bool {
+	return l.memory > 0 || l.cpu > 0
+}
+
+// parseMemoryLimit parses the value of a MEMORY_LIMIT tag, a number of bytes
+// with an optional K, M, G or T suffix, e.g. "512M"
+func parseMemoryLimit(s string) (int64, error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return 0, nil
+	}
+	num, multiplier := s, int64(1)
+	suffixes := map[string]int64{"K": 1 << 10, "M": 1 << 20, "G": 1 << 30, "T": 1 << 40}
+	if m, ok := suffixes[strings.ToUpper(s[len(s)-1:])]; ok {
+		num, multiplier = s[:len(s)-1], m
+	}
+	n, err := strconv.ParseInt(num, 10, 64)
+	if err != nil || n <= 0 {
+		return 0, fmt.Errorf("invalid MEMORY_LIMIT: %s", s)
+	}
+	return n * multiplier, nil
+}
+
+// parseCPULimit parses the value of a CPU_LIMIT tag, the number of CPUs a
+// test may use, e.g. "0.5" or "2"
+func parseCPULimit(s string) (float64, error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return 0, nil
+	}
+	n, err := strconv.ParseFloat(s, 64)
+	if err != nil || n <= 0 {
+		return 0, fmt.Errorf("invalid CPU_LIMIT: %s", s)
+	}
+	return n, nil
+}
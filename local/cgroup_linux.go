@@ -0,0 +1,288 @@
+package local
+
+import (
+	"bufio"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/linuxkit/rtf/logger"
+)
+
+// cgroupKillTimeout is how long to wait for the processes left in the cgroup
+// of a test to exit after they were killed
+const cgroupKillTimeout = 5 * time.Second
+
+// Cgroups puts each test into its own cgroup v2 sub-group of the cgroup rtf
+// was started in. That cgroup has to be delegated to the user running rtf,
+// e.g. by starting rtf with "systemd-run --user --scope -p Delegate=yes".
+// rtf moves itself into a leaf cgroup, so that the controllers needed for
+// resource limits can be enabled for the test cgroups.
+type Cgroups struct {
+	// dir is the cgroup rtf was started in
+	dir string
+	// runner is the leaf cgroup rtf moved itself into
+	runner string
+	// controllers are the controllers enabled for the test cgroups
+	controllers map[string]bool
+
+	mu sync.Mutex
+	n  int
+}
+
+// cgroup is the cgroup of a single test script
+type cgroup struct {
+	dir string
+	fd  *os.File
+}
+
+// NewCgroups sets up per-test cgroups. It returns an error describing why if
+// cgroup v2 is not available or the cgroup rtf runs in can not be used.
+func NewCgroups() (*Cgroups, error) {
+	mnt, err := cgroup2Mount()
+	if err != nil {
+		return nil, err
+	}
+	path, err := ownCgroup()
+	if err != nil {
+		return nil, err
+	}
+	c := &Cgroups{
+		dir:         filepath.Join(mnt, path),
+		controllers: map[string]bool{},
+	}
+
+	c.runner = filepath.Join(c.dir, fmt.Sprintf("rtf-%d-runner", os.Getpid()))
+	if err := os.Mkdir(c.runner, 0755); err != nil {
+		return nil, fmt.Errorf("cgroup %s is not delegated to this user: %v", c.dir, err)
+	}
+	if err := writeCgroupFile(c.runner, "cgroup.procs", strconv.Itoa(os.Getpid())); err != nil {
+		_ = os.Remove(c.runner)
+		return nil, fmt.Errorf("failed to move rtf into %s: %v", c.runner, err)
+	}
+
+	available, _ := readCgroupFile(c.dir, "cgroup.controllers")
+	for _, ctrl := range strings.Fields(available) {
+		if ctrl != "memory" && ctrl != "cpu" {
+			continue
+		}
+		// Fails if other processes are left in dir
+		if err := writeCgroupFile(c.dir, "cgroup.subtree_control", "+"+ctrl); err == nil {
+			c.controllers[ctrl] = true
+		}
+	}
+	return c, nil
+}
+
+// Controllers returns the controllers available to apply resource limits
+func (c *Cgroups) Controllers() []string {
+	var ctrls []string
+	for _, ctrl := range []string{"cpu", "memory"} {
+		if c.controllers[ctrl] {
+			ctrls = append(ctrls, ctrl)
+		}
+	}
+	return ctrls
+}
+
+// Close moves rtf back into the cgroup it was started in and removes the
+// cgroups created by it
+func (c *Cgroups) Close() error {
+	if c == nil {
+		return nil
+	}
+	for ctrl := range c.controllers {
+		_ = writeCgroupFile(c.dir, "cgroup.subtree_control", "-"+ctrl)
+	}
+	if err := writeCgroupFile(c.dir, "cgroup.procs", strconv.Itoa(os.Getpid())); err != nil {
+		return err
+	}
+	return os.Remove(c.runner)
+}
+
+// create creates the cgroup for a script and applies the limits to it. It
+// returns nil if per-test cgroups are not enabled.
+func (c *Cgroups) create(name string, limits resourceLimits, config RunConfig) (*cgroup, error) {
+	if c == nil {
+		return nil, nil
+	}
+	c.mu.Lock()
+	c.n++
+	n := c.n
+	c.mu.Unlock()
+
+	dir := filepath.Join(c.dir, fmt.Sprintf("rtf-%d-%d-%s", os.Getpid(), n, name))
+	if err := os.Mkdir(dir, 0755); err != nil {
+		return nil, err
+	}
+	if limits.memory > 0 {
+		if c.controllers["memory"] {
+			if err := writeCgroupFile(dir, "memory.max", strconv.FormatInt(limits.memory, 10)); err != nil {
+				_ = os.Remove(dir)
+				return nil, err
+			}
+		} else {
+			config.Logger.Log(logger.LevelWarning, fmt.Sprintf("MEMORY_LIMIT of %s not applied, the memory controller is not available", name))
+		}
+	}
+	if limits.cpu > 0 {
+		if c.controllers["cpu"] {
+			const period = 100000
+			quota := fmt.Sprintf("%d %d", int64(limits.cpu*period), period)
+			if err := writeCgroupFile(dir, "cpu.max", quota); err != nil {
+				_ = os.Remove(dir)
+				return nil, err
+			}
+		} else {
+			config.Logger.Log(logger.LevelWarning, fmt.Sprintf("CPU_LIMIT of %s not applied, the cpu controller is not available", name))
+		}
+	}
+	fd, err := os.Open(dir)
+	if err != nil {
+		_ = os.Remove(dir)
+		return nil, err
+	}
+	return &cgroup{dir: dir, fd: fd}, nil
+}
+
+// attach makes cmd start in the cgroup
+func (cg *cgroup) attach(cmd *exec.Cmd) {
+	if cmd.SysProcAttr == nil {
+		cmd.SysProcAttr = &syscall.SysProcAttr{}
+	}
+	cmd.SysProcAttr.UseCgroupFD = true
+	cmd.SysProcAttr.CgroupFD = int(cg.fd.Fd())
+}
+
+// destroy kills all processes left in the cgroup, removes it and returns
+// the resource usage of all processes which ran in it
+func (cg *cgroup) destroy(config RunConfig) *CgroupUsage {
+	defer func() { _ = cg.fd.Close() }()
+
+	u := &CgroupUsage{}
+	procs, _ := readCgroupFile(cg.dir, "cgroup.procs")
+	u.Killed = len(strings.Fields(procs))
+	if u.Killed > 0 {
+		if err := cg.kill(); err != nil {
+			config.Logger.Log(logger.LevelError, fmt.Sprintf("Failed to kill processes in %s: %v", cg.dir, err))
+		}
+	}
+
+	if stat, err := readCgroupKeyValues(cg.dir, "cpu.stat"); err == nil {
+		u.CPUUsage = time.Duration(stat["usage_usec"]) * time.Microsecond
+		u.UserTime = time.Duration(stat["user_usec"]) * time.Microsecond
+		u.SystemTime = time.Duration(stat["system_usec"]) * time.Microsecond
+	}
+	if peak, err := readCgroupFile(cg.dir, "memory.peak"); err == nil {
+		u.MemoryPeak, _ = strconv.ParseInt(strings.TrimSpace(peak), 10, 64)
+	}
+	if events, err := readCgroupKeyValues(cg.dir, "memory.events"); err == nil {
+		u.OOMKills = events["oom_kill"]
+	}
+
+	if err := os.Remove(cg.dir); err != nil {
+		config.Logger.Log(logger.LevelError, fmt.Sprintf("Failed to remove %s: %v", cg.dir, err))
+	}
+	return u
+}
+
+// kill kills all processes in the cgroup and waits for them to exit
+func (cg *cgroup) kill() error {
+	// cgroup.kill is only available with Linux 5.14 or later
+	useKillFile := writeCgroupFile(cg.dir, "cgroup.kill", "1") == nil
+	deadline := time.Now().Add(cgroupKillTimeout)
+	for {
+		procs, err := readCgroupFile(cg.dir, "cgroup.procs")
+		if err != nil {
+			return err
+		}
+		pids := strings.Fields(procs)
+		if len(pids) == 0 {
+			return nil
+		}
+		if time.Now().After(deadline) {
+			return fmt.Errorf("%d processes did not exit", len(pids))
+		}
+		if !useKillFile {
+			for _, p := range pids {
+				if pid, err := strconv.Atoi(p); err == nil {
+					_ = syscall.Kill(pid, syscall.SIGKILL)
+				}
+			}
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// cgroup2Mount returns where the cgroup v2 hierarchy is mounted
+func cgroup2Mount() (string, error) {
+	f, err := os.Open("/proc/self/mountinfo")
+	if err != nil {
+		return "", err
+	}
+	defer func() { _ = f.Close() }()
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		// The file system type follows the "-" separator, see proc(5)
+		fields := strings.Fields(scanner.Text())
+		for i, field := range fields {
+			if field == "-" && i+1 < len(fields) && fields[i+1] == "cgroup2" && len(fields) > 4 {
+				return fields[4], nil
+			}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return "", err
+	}
+	return "", fmt.Errorf("no cgroup v2 file system is mounted")
+}
+
+// ownCgroup returns the cgroup v2 path of the current process
+func ownCgroup() (string, error) {
+	data, err := ioutil.ReadFile("/proc/self/cgroup")
+	if err != nil {
+		return "", err
+	}
+	for _, l := range strings.Split(string(data), "\n") {
+		if strings.HasPrefix(l, "0::") {
+			return strings.TrimPrefix(l, "0::"), nil
+		}
+	}
+	return "", fmt.Errorf("the current process is not in a cgroup v2 hierarchy")
+}
+
+func readCgroupFile(dir, file string) (string, error) {
+	data, err := ioutil.ReadFile(filepath.Join(dir, file))
+	return string(data), err
+}
+
+func writeCgroupFile(dir, file, value string) error {
+	return ioutil.WriteFile(filepath.Join(dir, file), []byte(value), 0644)
+}
+
+// readCgroupKeyValues reads a cgroup file with "key value" lines, such as
+// cpu.stat or memory.events
+func readCgroupKeyValues(dir, file string) (map[string]int64, error) {
+	data, err := readCgroupFile(dir, file)
+	if err != nil {
+		return nil, err
+	}
+	values := map[string]int64{}
+	for _, l := range strings.Split(data, "\n") {
+		fields := strings.Fields(l)
+		if len(fields) != 2 {
+			continue
+		}
+		if v, err := strconv.ParseInt(fields[1], 10, 64); err == nil {
+			values[fields[0]] = v
+		}
+	}
+	return values, nil
+}
@@ -0,0 +1,44 @@
+//go:build !linux
+// +build !linux
+
+package local
+
+import (
+	"fmt"
+	"os/exec"
+)
+
+// Cgroups puts each test into its own cgroup, which is only supported on Linux
+type Cgroups struct{}
+
+// cgroup is the cgroup of a single test script
+type cgroup struct{}
+
+// NewCgroups always returns an error as cgroups are only supported on Linux
+func NewCgroups() (*Cgroups, error) {
+	return nil, fmt.Errorf("cgroups are only supported on Linux")
+}
+
+// Controllers returns the controllers available to apply resource limits
+func (c *Cgroups) Controllers() []string {
+	return nil
+}
+
+// Close is a no-op
+func (c *Cgroups) Close() error {
+	return nil
+}
+
+// create always returns nil as per-test cgroups are not supported
+func (c *Cgroups) create(name string, limits resourceLimits, config RunConfig) (*cgroup, error) {
+	return nil, nil
+}
+
+// attach is a no-op
+func (cg *cgroup) attach(cmd *exec.Cmd) {
+}
+
+// destroy is a no-op
+func (cg *cgroup) destroy(config RunConfig) *CgroupUsage {
+	return nil
+}
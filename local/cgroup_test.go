@@ -0,0 +1,37 @@
+package local
+
+import "testing"
+
+func TestParseMemoryLimit(t *testing.T) {
+	for s, exp := range map[string]int64{"": 0, "4096": 4096, "512M": 512 << 20, "2g": 2 << 30} {
+		got, err := parseMemoryLimit(s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != exp {
+			t.Fatalf("Expected %q to parse as %d, got %d", s, exp, got)
+		}
+	}
+	for _, s := range []string{"M", "-1G", "1.5G", "lots"} {
+		if _, err := parseMemoryLimit(s); err == nil {
+			t.Fatalf("Expected an error for %q", s)
+		}
+	}
+}
+
+func TestParseCPULimit(t *testing.T) {
+	for s, exp := range map[string]float64{"": 0, "0.5": 0.5, "2": 2} {
+		got, err := parseCPULimit(s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != exp {
+			t.Fatalf("Expected %q to parse as %v, got %v", s, exp, got)
+		}
+	}
+	for _, s := range []string{"0", "-1", "all"} {
+		if _, err := parseCPULimit(s); err == nil {
+			t.Fatalf("Expected an error for %q", s)
+		}
+	}
+}
@@ -0,0 +1,119 @@
+package local
+
+import (
+	"fmt"
+	"strings"
+)
+
+// tests returns all tests in the group and its sub-groups
+func (g *Group) tests() []*Test {
+	var tests []*Test
+	for _, c := range g.Children {
+		switch c := c.(type) {
+		case *Group:
+			tests = append(tests, c.tests()...)
+		case *Test:
+			tests = append(tests, c)
+		}
+	}
+	return tests
+}
+
+// resolveDependencies resolves the names in the DEPENDS tags of all tests in
+// the group to tests and checks that the dependencies do not form a cycle.
+// A name may either be the full name of a test or the name of a test in the
+// same group.
+func (g *Group) resolveDependencies() error {
+	tests := g.tests()
+	byName := map[string]*Test{}
+	for _, t := range tests {
+		byName[t.Name()] = t
+	}
+
+	for _, t := range tests {
+		t.Depends = nil
+		for _, name := range t.dependsOn {
+			dep, ok := byName[name]
+			if !ok {
+				dep, ok = byName[t.Parent.Name()+"."+name]
+			}
+			if !ok {
+				return fmt.Errorf("%s: unknown dependency %s", t.Name(), name)
+			}
+			t.Depends = append(t.Depends, dep)
+		}
+	}
+
+	const (
+		unvisited = iota
+		visiting
+		visited
+	)
+	state := map[*Test]int{}
+	var path []string
+	var visit func(t *Test) error
+	visit = func(t *Test) error {
+		switch state[t] {
+		case visiting:
+			return fmt.Errorf("dependency cycle: %s -> %s", strings.Join(path, " -> "), t.Name())
+		case visited:
+			return nil
+		}
+		state[t] = visiting
+		path = append(path, t.Name())
+		for _, dep := range t.Depends {
+			if err := visit(dep); err != nil {
+				return err
+			}
+		}
+		path = path[:len(path)-1]
+		state[t] = visited
+		return nil
+	}
+	for _, t := range tests {
+		if err := visit(t); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// addPrerequisites adds the transitive dependencies of the tests in selected
+// to it. It returns the tests which were added.
+func (g *Group) addPrerequisites(selected map[string]bool) map[string]bool {
+	added := map[string]bool{}
+	var add func(t *Test)
+	add = func(t *Test) {
+		for _, dep := range t.Depends {
+			if !selected[dep.Name()] {
+				selected[dep.Name()] = true
+				added[dep.Name()] = true
+			}
+			add(dep)
+		}
+	}
+	for _, t := range g.tests() {
+		if selected[t.Name()] {
+			add(t)
+		}
+	}
+	return added
+}
+
+// unmetDependency returns the reason why a test should not run if one of its
+// dependencies did not pass, or "" if all of them passed
+func unmetDependency(dep *Test, results []Result) string {
+	for _, r := range results {
+		switch r.TestResult {
+		case Pass, Flaky:
+			continue
+		case Fail, Timeout:
+			return fmt.Sprintf("dependency %s failed", dep.Name())
+		case Cancel:
+			return fmt.Sprintf("dependency %s was cancelled", dep.Name())
+		default:
+			return fmt.Sprintf("dependency %s was skipped", dep.Name())
+		}
+	}
+	return ""
+}
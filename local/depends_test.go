@@ -0,0 +1,67 @@
+package local
+
+import (
+	"reflect"
+	"testing"
+)
+
+func newDependsProject(deps map[string][]string) (*Group, map[string]*Test) {
+	root := &Group{Tags: &Tags{Name: "p"}}
+	sub := &Group{Parent: root, Tags: &Tags{Name: "p.sub"}}
+	root.Children = append(root.Children, sub)
+	tests := map[string]*Test{}
+	for _, name := range []string{"p.install", "p.sub.upgrade", "p.sub.remove"} {
+		parent := root
+		if name != "p.install" {
+			parent = sub
+		}
+		t := &Test{Parent: parent, Tags: &Tags{Name: name}, dependsOn: deps[name]}
+		parent.Children = append(parent.Children, t)
+		tests[name] = t
+	}
+	return root, tests
+}
+
+func TestResolveDependencies(t *testing.T) {
+	root, tests := newDependsProject(map[string][]string{
+		"p.sub.upgrade": {"p.install"},
+		"p.sub.remove":  {"upgrade"},
+	})
+	if err := root.resolveDependencies(); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(tests["p.sub.upgrade"].Depends, []*Test{tests["p.install"]}) {
+		t.Fatalf("Dependency on a full test name was not resolved")
+	}
+	if !reflect.DeepEqual(tests["p.sub.remove"].Depends, []*Test{tests["p.sub.upgrade"]}) {
+		t.Fatalf("Dependency on a test in the same group was not resolved")
+	}
+
+	selected := map[string]bool{"p.sub.remove": true}
+	added := root.addPrerequisites(selected)
+	if exp := map[string]bool{"p.sub.upgrade": true, "p.install": true}; !reflect.DeepEqual(added, exp) {
+		t.Fatalf("\nExpected prerequisites: %v\nGot: %v\n", exp, added)
+	}
+	exp := map[string]bool{"p.sub.remove": true, "p.sub.upgrade": true, "p.install": true}
+	if !reflect.DeepEqual(selected, exp) {
+		t.Fatalf("\nExpected: %v\nGot: %v\n", exp, selected)
+	}
+}
+
+func TestResolveDependenciesErrors(t *testing.T) {
+	root, _ := newDependsProject(map[string][]string{
+		"p.install": {"p.missing"},
+	})
+	if err := root.resolveDependencies(); err == nil || err.Error() != "p.install: unknown dependency p.missing" {
+		t.Fatalf("Unexpected error for an unknown dependency: %v", err)
+	}
+
+	root, _ = newDependsProject(map[string][]string{
+		"p.install":     {"p.sub.remove"},
+		"p.sub.upgrade": {"p.install"},
+		"p.sub.remove":  {"upgrade"},
+	})
+	if err := root.resolveDependencies(); err == nil || err.Error() != "dependency cycle: p.sub.upgrade -> p.install -> p.sub.remove -> p.sub.upgrade" {
+		t.Fatalf("Unexpected error for a dependency cycle: %v", err)
+	}
+}
@@ -0,0 +1,72 @@
+package local
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// redactedKeys are substrings of environment variable names whose values are
+// not written to the logs
+var redactedKeys = []string{"PASSWORD", "PASSWD", "SECRET", "TOKEN", "CREDENTIAL", "PRIVATE", "AUTH", "API_KEY", "ACCESS_KEY"}
+
+// ParseEnv validates a list of KEY=VALUE environment variables
+func ParseEnv(vars []string) ([]string, error) {
+	for _, v := range vars {
+		parts := strings.SplitN(v, "=", 2)
+		if len(parts) != 2 || parts[0] == "" {
+			return nil, fmt.Errorf("invalid environment variable %q, expected KEY=VALUE", v)
+		}
+	}
+	return vars, nil
+}
+
+// ReadEnvFile reads KEY=VALUE environment variables, one per line, from a
+// file. Empty lines and lines starting with '#' are ignored.
+func ReadEnvFile(path string) ([]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = f.Close() }()
+
+	var vars []string
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		l := strings.TrimSpace(scanner.Text())
+		if l == "" || strings.HasPrefix(l, "#") {
+			continue
+		}
+		vars = append(vars, l)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if _, err := ParseEnv(vars); err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	return vars, nil
+}
+
+// parseEnvTag parses the value of an ENV tag, a space separated list of
+// KEY=VALUE pairs
+func parseEnvTag(s string) ([]string, error) {
+	return ParseEnv(strings.Fields(s))
+}
+
+// redactEnv returns a KEY=VALUE environment variable with the value hidden
+// if the name suggests that it contains a secret
+func redactEnv(kv string) string {
+	parts := strings.SplitN(kv, "=", 2)
+	if len(parts) != 2 {
+		return kv
+	}
+	key := strings.ToUpper(parts[0])
+	for _, r := range redactedKeys {
+		if strings.Contains(key, r) {
+			return parts[0] + "=<redacted>"
+		}
+	}
+	return kv
+}
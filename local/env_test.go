@@ -0,0 +1,57 @@
+package local
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestParseEnv(t *testing.T) {
+	if _, err := ParseEnv([]string{"FOO=bar", "EMPTY=", "URL=http://x?a=b"}); err != nil {
+		t.Fatal(err)
+	}
+	for _, v := range []string{"FOO", "=bar"} {
+		if _, err := ParseEnv([]string{v}); err == nil {
+			t.Fatalf("Expected an error parsing %q", v)
+		}
+	}
+}
+
+func TestReadEnvFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "rtf")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = os.RemoveAll(dir) }()
+
+	f := filepath.Join(dir, "env")
+	if err := ioutil.WriteFile(f, []byte("# comment\nFOO=foo\n\n  BAR=bar baz\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	env, err := ReadEnvFile(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	exp := []string{"FOO=foo", "BAR=bar baz"}
+	if !reflect.DeepEqual(env, exp) {
+		t.Fatalf("Reading environment file failed: %v != %v", env, exp)
+	}
+}
+
+func TestRedactEnv(t *testing.T) {
+	for _, tt := range []struct {
+		in  string
+		out string
+	}{
+		{"FOO=foo", "FOO=foo"},
+		{"GITHUB_TOKEN=abc", "GITHUB_TOKEN=<redacted>"},
+		{"db_password=abc", "db_password=<redacted>"},
+		{"AWS_SECRET_ACCESS_KEY=abc", "AWS_SECRET_ACCESS_KEY=<redacted>"},
+	} {
+		if out := redactEnv(tt.in); out != tt.out {
+			t.Fatalf("\nExpected: %s\nGot: %s\n", tt.out, out)
+		}
+	}
+}
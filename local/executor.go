@@ -0,0 +1,295 @@
+package local
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+)
+
+// Executor runs the test, group and pre/post-test scripts of a kind, e.g.
+// shell or Python scripts
+type Executor interface {
+	// Command returns the command to run script with args
+	Command(script string, args []string, config RunConfig) (*exec.Cmd, error)
+	// Lib returns the helper library for the scripts, exposed as RT_LIB,
+	// given the root directory of rtf, or "" if there is none
+	Lib(rootDir string) string
+	// SetupEnv adjusts the environment of the scripts, e.g. to add dir,
+	// the directory of the helper applications, to their search path
+	SetupEnv(env *[]string, dir string)
+}
+
+var (
+	// executors are the registered executors by file extension
+	executors = map[string]Executor{}
+	// extensions are the registered file extensions in the order in which
+	// scripts with them are looked for
+	extensions []string
+	// interpreters are the registered executors by the name of the
+	// interpreter in the shebang line of a script, which provide its
+	// library and environment
+	interpreters = map[string]Executor{}
+)
+
+// RegisterExecutor registers an executor for scripts with the file extension
+// ext, e.g. ".py". Tests and groups are discovered for all registered
+// extensions. If a directory contains scripts with several of them, the
+// script with the extension registered first is used. Registering an
+// extension again replaces its executor.
+func RegisterExecutor(ext string, e Executor) {
+	if _, ok := executors[ext]; !ok {
+		extensions = append(extensions, ext)
+	}
+	executors[ext] = e
+}
+
+// RegisterInterpreter registers an executor for scripts without a registered
+// extension whose shebang line names the interpreter, e.g. "python3" for
+// "#!/usr/bin/python3" or "#!/usr/bin/env python3". The scripts are still run
+// directly, so that the whole shebang line applies, and only the library and
+// the environment of the executor are used for them.
+func RegisterInterpreter(name string, e Executor) {
+	interpreters[name] = e
+}
+
+// executorFor returns the executor for script by its extension. Other
+// executables are run directly, which leaves their shebang line, including
+// any arguments, to the operating system. Their library and environment are
+// those of the executor of the interpreter in the shebang line, if it is
+// registered.
+func executorFor(script string) (Executor, error) {
+	if e, ok := executors[filepath.Ext(script)]; ok {
+		return e, nil
+	}
+	if fi, err := os.Stat(script); err != nil || !isExecutable(fi) {
+		return nil, fmt.Errorf("no executor for %s", script)
+	}
+	interp, err := shebangInterpreter(script)
+	if err != nil {
+		return nil, err
+	}
+	if e, ok := interpreters[interp]; ok {
+		return shebangExecutor{e}, nil
+	}
+	return nativeExecutor{}, nil
+}
+
+// shebangInterpreter returns the name of the interpreter in the shebang line
+// of script, looking through /usr/bin/env, or "" if there is none
+func shebangInterpreter(script string) (string, error) {
+	f, err := os.Open(script)
+	if err != nil {
+		return "", err
+	}
+	defer func() { _ = f.Close() }()
+
+	line, err := bufio.NewReader(f).ReadString('\n')
+	if !strings.HasPrefix(line, "#!") {
+		return "", nil
+	}
+	if err != nil && line == "" {
+		return "", err
+	}
+	fields := strings.Fields(strings.TrimPrefix(line, "#!"))
+	if len(fields) == 0 {
+		return "", nil
+	}
+	interp := filepath.Base(fields[0])
+	if interp == "env" {
+		// Skip options of env, e.g. "-S"
+		for _, f := range fields[1:] {
+			if !strings.HasPrefix(f, "-") {
+				return filepath.Base(f), nil
+			}
+		}
+		return "", nil
+	}
+	return interp, nil
+}
+
+// checkScript checks if a script with 'name' and a registered extension, or
+// an executable called 'name', exists in 'path'
+func checkScript(path, name string) (string, error) {
+	for _, ext := range extensions {
+		f := filepath.Join(path, name+ext)
+		if _, err := os.Stat(f); err == nil {
+			return f, nil
+		}
+	}
+	f := filepath.Join(path, name)
+	if fi, err := os.Stat(f); err == nil && isExecutable(fi) {
+		return f, nil
+	}
+	return "", fmt.Errorf("no %s script found in %s", name, path)
+}
+
+// isScript returns true if file is called 'name' with a registered extension,
+// or is an executable called 'name'
+func isScript(file os.FileInfo, name string) bool {
+	if file.Name() == name {
+		return isExecutable(file)
+	}
+	ext := filepath.Ext(file.Name())
+	_, ok := executors[ext]
+	return ok && strings.TrimSuffix(file.Name(), ext) == name
+}
+
+// isExecutable returns true if file is a regular file which can be executed.
+// On Windows, executables are recognised by their extension instead.
+func isExecutable(file os.FileInfo) bool {
+	return runtime.GOOS != "windows" && file.Mode().IsRegular() && file.Mode()&0111 != 0
+}
+
+// interpreterExecutor runs scripts with an interpreter
+type interpreterExecutor struct {
+	// interpreter returns the path of the interpreter or "" if there is
+	// none, in which case the scripts can not be run
+	interpreter func() string
+	// args are passed to the interpreter before the script
+	args []string
+	// traceArgs are passed to the interpreter if the commands run by the
+	// scripts should be logged (-x)
+	traceArgs []string
+	// lib is the name of the helper library in the lib directory of rtf
+	lib string
+	// shell scripts are run by a POSIX shell, which uses PATH with ':'
+	// as the separator, also on Windows
+	shell bool
+}
+
+// Command returns the command to run script with the interpreter
+func (e *interpreterExecutor) Command(script string, args []string, config RunConfig) (*exec.Cmd, error) {
+	interp := e.interpreter()
+	if interp == "" {
+		return nil, fmt.Errorf("can't find a suitable interpreter to execute %s", script)
+	}
+	cmdArgs := append([]string{}, e.args...)
+	if config.Extra {
+		cmdArgs = append(cmdArgs, e.traceArgs...)
+	}
+	cmdArgs = append(cmdArgs, script)
+	cmdArgs = append(cmdArgs, args...)
+	return exec.Command(interp, cmdArgs...), nil
+}
+
+// Lib returns the helper library of the scripts, if the interpreter has one
+func (e *interpreterExecutor) Lib(rootDir string) string {
+	if e.lib == "" {
+		return ""
+	}
+	return filepath.Join(rootDir, "lib", e.lib)
+}
+
+// SetupEnv adds dir to the search path of the scripts
+func (e *interpreterExecutor) SetupEnv(env *[]string, dir string) {
+	if e.shell {
+		setEnv(env, "PATH", fmt.Sprintf("%s:%s", dir, getEnv(*env, "PATH")))
+		if runtime.GOOS == "windows" {
+			setEnv(env, "MSYS_NO_PATHCONV", "1")
+		}
+		return
+	}
+	prependPath(env, dir)
+}
+
+// nativeExecutor runs executables directly
+type nativeExecutor struct{}
+
+// Command returns the command to run the executable
+func (nativeExecutor) Command(script string, args []string, config RunConfig) (*exec.Cmd, error) {
+	return exec.Command(script, args...), nil
+}
+
+// Lib returns the shell library, as the executable may run shell scripts
+func (nativeExecutor) Lib(rootDir string) string {
+	return filepath.Join(rootDir, "lib", "lib.sh")
+}
+
+// SetupEnv adds dir to the search path of the executable
+func (nativeExecutor) SetupEnv(env *[]string, dir string) {
+	prependPath(env, dir)
+}
+
+// shebangExecutor runs executable scripts directly, with the library and
+// environment of the executor of their interpreter
+type shebangExecutor struct {
+	Executor
+}
+
+// Command returns the command to run the script directly
+func (shebangExecutor) Command(script string, args []string, config RunConfig) (*exec.Cmd, error) {
+	return exec.Command(script, args...), nil
+}
+
+// prependPath adds dir to the front of the native search path
+func prependPath(env *[]string, dir string) {
+	key := "PATH"
+	if runtime.GOOS == "windows" {
+		key = "Path"
+	}
+	setEnv(env, key, fmt.Sprintf("%s%c%s", dir, os.PathListSeparator, getEnv(*env, key)))
+}
+
+// lookPath returns a function which finds the first of names in PATH
+func lookPath(names ...string) func() string {
+	return func() string {
+		for _, n := range names {
+			if p, err := exec.LookPath(n); err == nil {
+				return p
+			}
+		}
+		return ""
+	}
+}
+
+func init() {
+	sh := &interpreterExecutor{
+		interpreter: func() string { return shExecutable },
+		traceArgs:   []string{"-x"},
+		lib:         "lib.sh",
+		shell:       true,
+	}
+	// bash.exe is the shell on Windows anyway
+	bashPath := lookPath("bash")
+	if runtime.GOOS == "windows" {
+		bashPath = sh.interpreter
+	}
+	bash := &interpreterExecutor{
+		interpreter: bashPath,
+		traceArgs:   []string{"-x"},
+		lib:         "lib.sh",
+		shell:       true,
+	}
+	psPath := lookPath("pwsh")
+	if runtime.GOOS == "windows" {
+		psPath = func() string { return "powershell.exe" }
+	}
+	pwsh := &interpreterExecutor{
+		interpreter: psPath,
+		args:        []string{"-NoProfile", "-NonInteractive"},
+		lib:         "lib.ps1",
+	}
+	python := &interpreterExecutor{
+		interpreter: lookPath("python3", "python"),
+	}
+
+	// On Windows, powershell scripts take precedence over shell scripts
+	if runtime.GOOS == "windows" {
+		RegisterExecutor(".ps1", pwsh)
+		RegisterExecutor(".exe", nativeExecutor{})
+	}
+	RegisterExecutor(".sh", sh)
+	RegisterExecutor(".bash", bash)
+	RegisterExecutor(".ps1", pwsh)
+	RegisterExecutor(".py", python)
+
+	RegisterInterpreter("sh", sh)
+	RegisterInterpreter("bash", bash)
+	RegisterInterpreter("pwsh", pwsh)
+	RegisterInterpreter("python", python)
+	RegisterInterpreter("python3", python)
+}
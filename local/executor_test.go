@@ -0,0 +1,209 @@
+package local
+
+import (
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"github.com/linuxkit/rtf/logger"
+)
+
+func TestShebangInterpreter(t *testing.T) {
+	dir, err := ioutil.TempDir("", "rtf")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = os.RemoveAll(dir) }()
+
+	tests := map[string]string{
+		"#!/bin/sh\necho\n":                  "sh",
+		"#!/usr/bin/env python3\n":           "python3",
+		"#! /usr/bin/env -S bash -e\n":       "bash",
+		"#!/usr/local/bin/pwsh -NoProfile\n": "pwsh",
+		"#!/usr/bin/env\n":                   "",
+		"# SUMMARY: no shebang\n":            "",
+		"":                                   "",
+	}
+	for content, exp := range tests {
+		f := filepath.Join(dir, "test")
+		if err := ioutil.WriteFile(f, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+		interp, err := shebangInterpreter(f)
+		if err != nil {
+			t.Fatalf("Unexpected error for %q: %v", content, err)
+		}
+		if interp != exp {
+			t.Errorf("Expected %q for %q, got %q", exp, content, interp)
+		}
+	}
+}
+
+func TestCheckScript(t *testing.T) {
+	dir, err := ioutil.TempDir("", "rtf")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = os.RemoveAll(dir) }()
+
+	if IsTest(dir) {
+		t.Fatalf("Expected no test in an empty directory")
+	}
+	for _, f := range []string{"test.py", "test.txt"} {
+		if err := ioutil.WriteFile(filepath.Join(dir, f), nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if p, err := checkScript(dir, TestFileName); err != nil || p != filepath.Join(dir, "test.py") {
+		t.Fatalf("Expected test.py, got %q %v", p, err)
+	}
+	// Shell scripts take precedence
+	if err := ioutil.WriteFile(filepath.Join(dir, "test.sh"), nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if p, err := checkScript(dir, TestFileName); err != nil || p != filepath.Join(dir, "test.sh") {
+		t.Fatalf("Expected test.sh, got %q %v", p, err)
+	}
+
+	for f, exp := range map[string]bool{"test.sh": false, "group.bash": true, "group.txt": false} {
+		if err := ioutil.WriteFile(filepath.Join(dir, f), nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+		fi, err := os.Stat(filepath.Join(dir, f))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if isScript(fi, GroupFileName) != exp {
+			t.Errorf("Expected isScript to return %v for %s", exp, f)
+		}
+	}
+}
+
+func TestExecutableTest(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("executables are recognised by their extension on Windows")
+	}
+	dir, err := ioutil.TempDir("", "rtf")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = os.RemoveAll(dir) }()
+	config := RunConfig{
+		CaseDir: dir,
+		LogDir:  dir,
+		Logger:  logger.NewLogDispatcher(map[string]logger.Logger{}),
+	}
+
+	// A test file which is not executable is ignored
+	script := filepath.Join(dir, "test")
+	content := "#!/bin/sh\n# SUMMARY: A shell test\nexit 0\n"
+	if err := ioutil.WriteFile(script, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if IsTest(dir) {
+		t.Fatalf("Expected a non-executable test file to be ignored")
+	}
+	if err := os.Chmod(script, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if !IsTest(dir) {
+		t.Fatalf("Expected an executable test file to be found")
+	}
+	tags, err := scriptTags(script)
+	if err != nil || tags.Summary != "A shell test" {
+		t.Fatalf("Expected tags from the script, got %+v %v", tags, err)
+	}
+	if e, err := executorFor(script); err != nil || e != (shebangExecutor{executors[".sh"]}) {
+		t.Fatalf("Expected the shell executor for a shell shebang, got %v %v", e, err)
+	}
+
+	// The script is run directly, so the arguments in the shebang line apply
+	content = "#!/bin/sh -e\n[ -n \"$RT_LIB\" ]\nfalse\nexit 0\n"
+	if err := ioutil.WriteFile(script, []byte(content), 0755); err != nil {
+		t.Fatal(err)
+	}
+	res, err := executeScript(script, dir, "shebang", nil, scriptOptions{}, config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.TestResult != Fail {
+		t.Fatalf("Expected the -e of the shebang line to fail the script, got %s", TestResultNames[res.TestResult])
+	}
+
+	// Binaries are run directly, with tags from the meta file
+	bin, err := exec.LookPath("true")
+	if err != nil {
+		t.Skip("true is not installed")
+	}
+	data, err := ioutil.ReadFile(bin)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(script, data, 0755); err != nil {
+		t.Fatal(err)
+	}
+	tags, err = scriptTags(script)
+	if err != nil || tags.Summary != "" {
+		t.Fatalf("Expected no tags for a binary, got %+v %v", tags, err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, "test.meta"), []byte("# SUMMARY: A binary test\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	tags, err = scriptTags(script)
+	if err != nil || tags.Summary != "A binary test" {
+		t.Fatalf("Expected tags from the meta file, got %+v %v", tags, err)
+	}
+	if e, err := executorFor(script); err != nil || e != (nativeExecutor{}) {
+		t.Fatalf("Expected the native executor for a binary, got %v %v", e, err)
+	}
+	res, err = executeScript(script, dir, "binary", nil, scriptOptions{}, config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.TestResult != Pass {
+		t.Fatalf("Expected result %s, got %s", TestResultNames[Pass], TestResultNames[res.TestResult])
+	}
+}
+
+func TestExecuteScriptPython(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("the environment differs on Windows")
+	}
+	if _, err := exec.LookPath("python3"); err != nil {
+		t.Skip("python3 is not installed")
+	}
+	dir, err := ioutil.TempDir("", "rtf")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = os.RemoveAll(dir) }()
+
+	script := filepath.Join(dir, "test.py")
+	content := `# SUMMARY: A python test
+import os, sys
+print("RT_METRIC: args=%d" % (len(sys.argv) - 1))
+# There is no library for Python scripts
+sys.exit(0 if os.environ["RT_TEST_NAME"] == "python" and "RT_LIB" not in os.environ else 1)
+`
+	if err := ioutil.WriteFile(script, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	config := RunConfig{
+		CaseDir: dir,
+		LogDir:  dir,
+		Logger:  logger.NewLogDispatcher(map[string]logger.Logger{}),
+	}
+	res, err := executeScript(script, dir, "python", []string{"a", "b"}, scriptOptions{}, config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.TestResult != Pass {
+		t.Fatalf("Expected result %s, got %s", TestResultNames[Pass], TestResultNames[res.TestResult])
+	}
+	if m := res.Metrics["args"]; m.Value != 2 {
+		t.Fatalf("Expected the arguments to be passed to the script, got %+v", res.Metrics)
+	}
+}
@@ -0,0 +1,39 @@
+package local
+
+import "sync"
+
+// FailureLimit keeps track of the number of failed tests so that a run can be
+// stopped once too many tests have failed. A nil *FailureLimit never stops a
+// run.
+type FailureLimit struct {
+	mu       sync.Mutex
+	max      int
+	failures int
+}
+
+// NewFailureLimit returns a new FailureLimit which is reached after max failures
+func NewFailureLimit(max int) *FailureLimit {
+	return &FailureLimit{max: max}
+}
+
+// add records the result of a test and returns true if this result caused
+// the limit to be reached
+func (f *FailureLimit) add(r TestResult) bool {
+	if f == nil || (r != Fail && r != Timeout) {
+		return false
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.failures++
+	return f.failures == f.max
+}
+
+// Reached returns true once the maximum number of failures has been reached
+func (f *FailureLimit) Reached() bool {
+	if f == nil {
+		return false
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.failures >= f.max
+}
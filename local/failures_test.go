@@ -0,0 +1,26 @@
+package local
+
+import "testing"
+
+func TestFailureLimit(t *testing.T) {
+	var nilLimit *FailureLimit
+	if nilLimit.add(Fail) || nilLimit.Reached() {
+		t.Fatalf("A nil FailureLimit should never be reached")
+	}
+
+	f := NewFailureLimit(2)
+	for _, r := range []TestResult{Pass, Skip, Cancel, Flaky} {
+		if f.add(r) {
+			t.Fatalf("%s should not count as a failure", TestResultNames[r])
+		}
+	}
+	if f.add(Fail) || f.Reached() {
+		t.Fatalf("Limit reached after one failure")
+	}
+	if !f.add(Timeout) || !f.Reached() {
+		t.Fatalf("Limit not reached after two failures")
+	}
+	if f.add(Fail) || !f.Reached() {
+		t.Fatalf("Limit should only be reported as reached once")
+	}
+}
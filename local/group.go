@@ -7,7 +7,6 @@ import (
 	"path/filepath"
 	"sort"
 	"strings"
-	"sync"
 	"time"
 )
 
@@ -29,7 +28,7 @@ func IsGroup(path string) bool {
 	}
 
 	for _, file := range files {
-		if file.Name() == GroupFileName+".sh" || file.Name() == GroupFileName+".ps1" {
+		if isScript(file, GroupFileName) {
 			return true
 		}
 		if file.IsDir() {
@@ -43,17 +42,30 @@ func IsGroup(path string) bool {
 func (g *Group) Init() error {
 	g.GroupFilePath, _ = checkScript(g.Path, GroupFileName)
 
-	tags, err := ParseTags(g.GroupFilePath)
-	if err != nil {
-		tags = &Tags{}
+	// Groups without a group script have no tags
+	g.Tags = &Tags{}
+	if g.GroupFilePath != "" {
+		tags, err := scriptTags(g.GroupFilePath)
+		if err != nil {
+			return err
+		}
+		g.Tags = tags
 	}
-	g.Tags = tags
 
 	var name string
 	var order int
 
 	g.Labels, g.NotLabels = ParseLabels(g.Tags.Labels)
 
+	env, err := parseEnvTag(g.Tags.Env)
+	if err != nil {
+		return fmt.Errorf("%s: %v", g.GroupFilePath, err)
+	}
+	if g.Parent != nil {
+		g.Env = append(g.Env, g.Parent.Env...)
+	}
+	g.Env = append(g.Env, env...)
+
 	order, name = getNameAndOrder(filepath.Base(g.Path))
 
 	if g.Parent == nil {
@@ -92,6 +104,10 @@ func (g *Group) Init() error {
 			}
 		}
 	}
+	if g.Parent == nil {
+		// The whole tree is loaded, so dependencies between tests can be resolved
+		return g.resolveDependencies()
+	}
 	return nil
 }
 
@@ -138,7 +154,7 @@ func (g *Group) Gather(config RunConfig) ([]TestContainer, int) {
 	var subCount int
 
 	if g.GroupFilePath != "" {
-		containers = append(containers, GroupCommand{Name: g.Name(), FilePath: g.GroupFilePath, Path: g.Path, Type: "init"})
+		containers = append(containers, GroupCommand{Name: g.Name(), FilePath: g.GroupFilePath, Path: g.Path, Type: "init", Env: g.Env})
 	}
 
 	for _, c := range g.Children {
@@ -152,7 +168,7 @@ func (g *Group) Gather(config RunConfig) ([]TestContainer, int) {
 	}
 
 	if g.GroupFilePath != "" {
-		containers = append(containers, GroupCommand{Name: g.Name(), FilePath: g.GroupFilePath, Path: g.Path, Type: "deinit"})
+		containers = append(containers, GroupCommand{Name: g.Name(), FilePath: g.GroupFilePath, Path: g.Path, Type: "deinit", Env: g.Env})
 	}
 
 	return containers, subCount
@@ -160,8 +176,6 @@ func (g *Group) Gather(config RunConfig) ([]TestContainer, int) {
 
 // Run will run all child groups and tests
 func (g *Group) Run(config RunConfig) ([]Result, error) {
-	var results []Result
-
 	// This gathers all of the individual tests and group init/deinit commands
 	// all the way down, leading to a flat list we can execute, rather than recursion.
 	// That should make it easier to break into shards.
@@ -174,49 +188,7 @@ func (g *Group) Run(config RunConfig) ([]Result, error) {
 		}}, nil
 	}
 
-	if config.Parallel {
-		var wg sync.WaitGroup
-		resCh := make(chan []Result, len(g.Children))
-		errCh := make(chan error, len(g.Children))
-
-		for _, c := range runnables {
-			wg.Add(1)
-			go func(c TestContainer, cf RunConfig) {
-				defer wg.Done()
-				res, err := c.Run(cf)
-				if err != nil {
-					errCh <- err
-				}
-				resCh <- res
-			}(c, config)
-		}
-
-		go func() {
-			wg.Wait()
-			close(resCh)
-			close(errCh)
-		}()
-
-		for err := range errCh {
-			if err != nil {
-				return results, err
-			}
-		}
-
-		for res := range resCh {
-			results = append(results, res...)
-		}
-	} else {
-		for _, r := range runnables {
-			res, err := r.Run(config)
-			if err != nil {
-				return results, err
-			}
-			results = append(results, res...)
-		}
-	}
-
-	return results, nil
+	return runJobs(runnables, config)
 }
 
 // Order returns the order of a group
@@ -233,6 +205,11 @@ func (g *Group) willRun(config RunConfig) bool {
 	if config.TestPattern == "" {
 		return true
 	}
+	for name := range config.prerequisites {
+		if strings.HasPrefix(name, g.Name()+".") {
+			return true
+		}
+	}
 
 	return strings.HasPrefix(config.TestPattern, g.Name()) || strings.HasPrefix(g.Name(), config.TestPattern)
 }
@@ -1,6 +1,10 @@
 package local
 
 import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
 	"testing"
 )
 
@@ -29,3 +33,27 @@ func TestCalculateShard(t *testing.T) {
 	}
 
 }
+
+func TestGroupInitInvalidTags(t *testing.T) {
+	dir, err := ioutil.TempDir("", "rtf")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = os.RemoveAll(dir) }()
+
+	f := filepath.Join(dir, "group.sh")
+	if err := ioutil.WriteFile(f, []byte("#!/bin/sh\n# TIMEOUT: 5 minutes\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	p, err := NewProject(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = p.Init()
+	if err == nil {
+		t.Fatal("Expected an error for the invalid TIMEOUT of the group")
+	}
+	if !strings.HasPrefix(err.Error(), f+": invalid TIMEOUT") {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+}
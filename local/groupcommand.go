@@ -10,10 +10,15 @@ import (
 // Run the group init or deinit command.
 func (g GroupCommand) Run(config RunConfig) ([]Result, error) {
 	config.Logger.Log(logger.LevelInfo, fmt.Sprintf("%s::%s()", g.Name, g.Type))
-	res, err := executeScript(g.FilePath, g.Path, "", []string{g.Type}, config)
+	res, err := executeScript(g.FilePath, g.Path, "", []string{g.Type}, scriptOptions{timeout: config.Timeout, env: g.Env}, config)
 	if err != nil {
 		return nil, err
 	}
+	if res.TestResult == Cancel && config.Interrupt.Interrupted() {
+		// Carry on so that the remaining deinit commands still run
+		config.Logger.Log(logger.LevelWarning, fmt.Sprintf("%s::%s() was interrupted", g.Name, g.Type))
+		return []Result{res}, nil
+	}
 	if res.TestResult != Pass {
 		return nil, fmt.Errorf("error running %s:%s", g.FilePath, g.Type)
 	}
@@ -0,0 +1,87 @@
+package local
+
+import (
+	"os"
+	"os/exec"
+	"sync"
+	"time"
+)
+
+// Interrupt tracks the scripts which are currently running so that they can
+// be stopped when a run is interrupted, e.g. by the user pressing Ctrl-C.
+// A nil *Interrupt is valid and is never interrupted.
+type Interrupt struct {
+	mu          sync.Mutex
+	interrupted bool
+	gracePeriod time.Duration
+	cmds        map[*exec.Cmd]bool
+}
+
+// NewInterrupt returns a new Interrupt. Scripts which are still running
+// gracePeriod after they were signalled are killed.
+func NewInterrupt(gracePeriod time.Duration) *Interrupt {
+	return &Interrupt{
+		gracePeriod: gracePeriod,
+		cmds:        map[*exec.Cmd]bool{},
+	}
+}
+
+// Signal marks the run as interrupted and forwards sig to the process group of
+// every running script. If the run was already interrupted, the scripts are
+// killed straight away.
+func (i *Interrupt) Signal(sig os.Signal) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	force := i.interrupted
+	i.interrupted = true
+	for cmd := range i.cmds {
+		i.cmds[cmd] = true
+		if force {
+			_ = killProcessGroup(cmd)
+			continue
+		}
+		_ = signalProcessGroup(cmd, sig)
+		c := cmd
+		time.AfterFunc(i.gracePeriod, func() {
+			i.mu.Lock()
+			defer i.mu.Unlock()
+			if _, ok := i.cmds[c]; ok {
+				_ = killProcessGroup(c)
+			}
+		})
+	}
+}
+
+// Interrupted returns true if the run was interrupted
+func (i *Interrupt) Interrupted() bool {
+	if i == nil {
+		return false
+	}
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	return i.interrupted
+}
+
+// register adds a started script to the set of running scripts
+func (i *Interrupt) register(cmd *exec.Cmd) {
+	if i == nil {
+		return
+	}
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	i.cmds[cmd] = false
+}
+
+// unregister removes a script from the set of running scripts and returns
+// true if it was signalled while it was running
+func (i *Interrupt) unregister(cmd *exec.Cmd) bool {
+	if i == nil {
+		return false
+	}
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	signalled := i.cmds[cmd]
+	delete(i.cmds, cmd)
+	return signalled
+}
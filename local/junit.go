@@ -0,0 +1,229 @@
+package local
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/linuxkit/rtf/logger"
+)
+
+// junitLogLines is the number of lines at the end of the log of a failed test
+// which are included in the JUnit report
+const junitLogLines = 50
+
+type junitTestSuites struct {
+	XMLName  xml.Name         `xml:"testsuites"`
+	Name     string           `xml:"name,attr,omitempty"`
+	Tests    int              `xml:"tests,attr"`
+	Failures int              `xml:"failures,attr"`
+	Skipped  int              `xml:"skipped,attr"`
+	Time     string           `xml:"time,attr"`
+	Suites   []junitTestSuite `xml:"testsuite"`
+}
+
+type junitTestSuite struct {
+	Name       string           `xml:"name,attr"`
+	Tests      int              `xml:"tests,attr"`
+	Failures   int              `xml:"failures,attr"`
+	Errors     int              `xml:"errors,attr"`
+	Skipped    int              `xml:"skipped,attr"`
+	Time       string           `xml:"time,attr"`
+	Timestamp  string           `xml:"timestamp,attr,omitempty"`
+	Properties *junitProperties `xml:"properties,omitempty"`
+	Cases      []junitTestCase  `xml:"testcase"`
+}
+
+// junitProperties is a separate element, so that it is omitted if there are no
+// properties
+type junitProperties struct {
+	Properties []junitProperty `xml:"property"`
+}
+
+type junitProperty struct {
+	Name  string `xml:"name,attr"`
+	Value string `xml:"value,attr"`
+}
+
+type junitTestCase struct {
+	Name       string           `xml:"name,attr"`
+	Classname  string           `xml:"classname,attr"`
+	Time       string           `xml:"time,attr"`
+	Properties *junitProperties `xml:"properties,omitempty"`
+	Failure    *junitMessage    `xml:"failure,omitempty"`
+	Skipped    *junitMessage    `xml:"skipped,omitempty"`
+	SystemOut  string           `xml:"system-out,omitempty"`
+}
+
+type junitMessage struct {
+	Message string `xml:"message,attr,omitempty"`
+	Type    string `xml:"type,attr,omitempty"`
+	Text    string `xml:",chardata"`
+}
+
+// WriteJUnit writes the results of a run as a JUnit XML report. Each group is
+// a test suite and each test iteration and sub-result a test case. Failed
+// tests include the end of their log in logDir.
+func WriteJUnit(w io.Writer, s Summary, logDir string) error {
+	var properties *junitProperties
+	addProperty := func(name, value string) {
+		if value != "" {
+			properties = addJUnitProperty(properties, name, value)
+		}
+	}
+	addProperty("id", s.ID)
+	addProperty("os", s.SystemInfo.OS)
+	addProperty("os.name", s.SystemInfo.Name)
+	addProperty("os.version", s.SystemInfo.Version)
+	addProperty("arch", s.SystemInfo.Arch)
+	addProperty("model", s.SystemInfo.Model)
+	addProperty("cpu", s.SystemInfo.CPU)
+	if s.SystemInfo.Memory > 0 {
+		addProperty("memory", strconv.FormatInt(s.SystemInfo.Memory, 10))
+	}
+	addProperty("labels", strings.Join(s.Labels, ", "))
+
+	report := junitTestSuites{Name: s.ID, Time: junitTime(s.EndTime.Sub(s.StartTime))}
+	suites := map[string]int{}
+	var durations []time.Duration
+	for _, r := range s.Results {
+		if r.Test == nil {
+			continue
+		}
+		suite := junitSuiteName(r.Test)
+		i, ok := suites[suite]
+		if !ok {
+			i = len(report.Suites)
+			suites[suite] = i
+			report.Suites = append(report.Suites, junitTestSuite{Name: suite, Properties: properties})
+			durations = append(durations, 0)
+			if !r.StartTime.IsZero() {
+				report.Suites[i].Timestamp = r.StartTime.UTC().Format("2006-01-02T15:04:05")
+			}
+		}
+		durations[i] += r.Duration
+
+		name := r.Name
+		if p := r.Test.Parent.Name(); p != "" {
+			name = strings.TrimPrefix(name, p+".")
+		}
+		name = strings.TrimPrefix(name, ".")
+		tc := junitTestCase{Name: name, Classname: suite, Time: junitTime(r.Duration)}
+		if r.Test.LabelString() != "" {
+			tc.Properties = addJUnitProperty(tc.Properties, "labels", r.Test.LabelString())
+		}
+		if r.Test.Tags.Issue != "" {
+			tc.Properties = addJUnitProperty(tc.Properties, "issue", r.Test.Tags.Issue)
+		}
+		switch r.TestResult {
+		case Fail, Timeout:
+			msg := fmt.Sprintf("exit code %d", r.ExitCode)
+			if r.TestResult == Timeout {
+				msg = "timed out"
+			} else if r.Signal != "" {
+				msg = fmt.Sprintf("terminated by signal %s", r.Signal)
+			}
+			tc.Failure = &junitMessage{
+				Message: msg,
+				Type:    TestResultNames[r.TestResult],
+				Text:    logTail(filepath.Join(logDir, r.Name+".log"), junitLogLines),
+			}
+		case Skip, Cancel:
+			msg := r.Reason
+			if r.TestResult == Cancel {
+				msg = "cancelled"
+			}
+			tc.Skipped = &junitMessage{Message: msg}
+		case Flaky:
+			tc.SystemOut = fmt.Sprintf("Passed after %d attempts", r.Attempts)
+		}
+		report.Suites[i].Cases = append(report.Suites[i].Cases, tc)
+
+		for _, sr := range r.SubResults {
+			sc := junitTestCase{Name: name + "/" + sr.Name, Classname: suite, Time: junitTime(sr.Duration)}
+			switch sr.TestResult {
+			case Fail, Timeout:
+				sc.Failure = &junitMessage{Message: sr.Reason, Type: TestResultNames[sr.TestResult], Text: sr.Output}
+			case Skip, Cancel:
+				sc.Skipped = &junitMessage{Message: sr.Reason}
+			}
+			report.Suites[i].Cases = append(report.Suites[i].Cases, sc)
+		}
+	}
+
+	for i := range report.Suites {
+		suite := &report.Suites[i]
+		suite.Time = junitTime(durations[i])
+		for _, tc := range suite.Cases {
+			suite.Tests++
+			if tc.Failure != nil {
+				suite.Failures++
+			}
+			if tc.Skipped != nil {
+				suite.Skipped++
+			}
+		}
+		report.Tests += suite.Tests
+		report.Failures += suite.Failures
+		report.Skipped += suite.Skipped
+	}
+
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "  ")
+	if err := enc.Encode(report); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w, "\n")
+	return err
+}
+
+// addJUnitProperty adds a property to props, which are created if they are nil
+func addJUnitProperty(props *junitProperties, name, value string) *junitProperties {
+	if props == nil {
+		props = &junitProperties{}
+	}
+	props.Properties = append(props.Properties, junitProperty{Name: name, Value: value})
+	return props
+}
+
+// junitSuiteName returns the name of the test suite of a test, the name of its
+// group. Tests at the top level are in a suite named after the case directory.
+func junitSuiteName(t *Test) string {
+	if name := strings.TrimPrefix(t.Parent.Name(), "."); name != "" {
+		return name
+	}
+	return filepath.Base(t.Parent.Path)
+}
+
+// junitTime formats a duration in seconds
+func junitTime(d time.Duration) string {
+	return strconv.FormatFloat(d.Seconds(), 'f', 3, 64)
+}
+
+// logTail returns the last n lines of a log file, without debug messages
+// such as the environment of the test, or "" if it can not be read
+func logTail(path string, n int) string {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return ""
+	}
+	debug := fmt.Sprintf("[%-8s]", logger.LevelNames[logger.LevelDebug])
+	var lines []string
+	for _, l := range strings.Split(strings.TrimRight(string(data), "\n"), "\n") {
+		if !strings.HasPrefix(l, debug) {
+			lines = append(lines, l)
+		}
+	}
+	if len(lines) > n {
+		lines = lines[len(lines)-n:]
+	}
+	return strings.Join(lines, "\n")
+}
@@ -0,0 +1,118 @@
+package local
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/linuxkit/rtf/sysinfo"
+)
+
+func TestWriteJUnit(t *testing.T) {
+	dir, err := ioutil.TempDir("", "rtf")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = os.RemoveAll(dir) }()
+
+	root := &Group{Path: "cases", Tags: &Tags{}}
+	foo := &Group{Parent: root, Path: "cases/010_foo", Tags: &Tags{Name: ".foo"}}
+	top := &Test{Parent: root, Tags: &Tags{Name: ".top"}}
+	bar := &Test{Parent: foo, Tags: &Tags{Name: ".foo.bar", Issue: "https://example.com/1"}, Labels: map[string]bool{"linux": true}}
+
+	var log []string
+	for i := 1; i <= 60; i++ {
+		log = append(log, fmt.Sprintf("line %d", i))
+		if i == 55 {
+			log = append(log, "[DEBUG   ] 2017-05-01T12:00:00Z: Environment: FOO=bar")
+		}
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, ".foo.bar.2.log"), []byte(strings.Join(log, "\n")+"\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	start := time.Date(2017, 5, 1, 12, 0, 0, 0, time.UTC)
+	s := Summary{
+		ID:         "1234",
+		StartTime:  start,
+		EndTime:    start.Add(10 * time.Second),
+		SystemInfo: sysinfo.SystemInfo{OS: "linux", Arch: "amd64"},
+		Labels:     []string{"linux", "!slow"},
+		Results: []Result{
+			{Test: top, Name: ".top", TestResult: Pass, StartTime: start, Duration: time.Second},
+			{Test: bar, Name: ".foo.bar.1", TestResult: Skip, Reason: "no kvm"},
+			{Test: bar, Name: ".foo.bar.2", TestResult: Fail, ExitCode: 2, Duration: 1500 * time.Millisecond,
+				SubResults: []SubResult{
+					{Name: "case1", TestResult: Pass, Duration: time.Second},
+					{Name: "case2", TestResult: Fail, Output: "boom"},
+				}},
+			{Test: bar, Name: ".foo.bar.3", TestResult: Cancel},
+			// Skipped groups have no test
+			{Name: ".skipped", TestResult: Skip},
+		},
+	}
+
+	var buf bytes.Buffer
+	if err := WriteJUnit(&buf, s, dir); err != nil {
+		t.Fatal(err)
+	}
+	var report junitTestSuites
+	if err := xml.Unmarshal(buf.Bytes(), &report); err != nil {
+		t.Fatalf("Invalid XML: %v\n%s", err, buf.String())
+	}
+
+	if report.Tests != 6 || report.Failures != 2 || report.Skipped != 2 || report.Time != "10.000" {
+		t.Fatalf("Unexpected totals: %+v", report)
+	}
+	if len(report.Suites) != 2 || report.Suites[0].Name != "cases" || report.Suites[1].Name != "foo" {
+		t.Fatalf("Expected the suites cases and foo, got %+v", report.Suites)
+	}
+	props := map[string]string{}
+	for _, p := range report.Suites[0].Properties.Properties {
+		props[p.Name] = p.Value
+	}
+	if props["id"] != "1234" || props["os"] != "linux" || props["arch"] != "amd64" || props["labels"] != "linux, !slow" {
+		t.Fatalf("Unexpected properties: %v", props)
+	}
+	if _, ok := props["cpu"]; ok {
+		t.Fatalf("Expected empty properties to be omitted: %v", props)
+	}
+	// Only the two suites and the three test cases of bar have properties
+	if n := strings.Count(buf.String(), "<properties>"); n != 5 || strings.Contains(buf.String(), "<properties></properties>") {
+		t.Fatalf("Expected test cases without properties to omit them, got %d in\n%s", n, buf.String())
+	}
+
+	cases := report.Suites[1].Cases
+	var names []string
+	for _, c := range cases {
+		names = append(names, c.Name)
+	}
+	if strings.Join(names, " ") != "bar.1 bar.2 bar.2/case1 bar.2/case2 bar.3" {
+		t.Fatalf("Unexpected test cases: %v", names)
+	}
+	if cases[0].Skipped == nil || cases[0].Skipped.Message != "no kvm" {
+		t.Fatalf("Expected a skipped test case, got %+v", cases[0])
+	}
+	f := cases[1].Failure
+	if f == nil || f.Message != "exit code 2" || f.Type != "Fail" || cases[1].Time != "1.500" {
+		t.Fatalf("Expected a failed test case, got %+v", cases[1])
+	}
+	if !strings.HasPrefix(f.Text, "line 11\n") || !strings.HasSuffix(f.Text, "line 60") || strings.Contains(f.Text, "DEBUG") {
+		t.Fatalf("Expected the last %d lines of the log, got %q", junitLogLines, f.Text)
+	}
+	if cases[1].Properties == nil || len(cases[1].Properties.Properties) != 2 {
+		t.Fatalf("Expected labels and issue as properties, got %+v", cases[1].Properties)
+	}
+	if cases[2].Failure != nil || cases[3].Failure == nil || cases[3].Failure.Text != "boom" {
+		t.Fatalf("Unexpected sub-results: %+v", cases[2:4])
+	}
+	if cases[4].Skipped == nil || cases[4].Skipped.Message != "cancelled" {
+		t.Fatalf("Expected a cancelled test case to be skipped, got %+v", cases[4])
+	}
+}
@@ -0,0 +1,163 @@
+package local
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// outputFormatTAP is the Test Anything Protocol, e.g. of bats
+	outputFormatTAP = "tap"
+	// outputFormatGoTestJSON is the output of go test -json
+	outputFormatGoTestJSON = "gotest-json"
+)
+
+// parseOutputFormat parses the value of an OUTPUT_FORMAT tag
+func parseOutputFormat(s string) (string, error) {
+	switch s = strings.TrimSpace(s); s {
+	case "", outputFormatTAP, outputFormatGoTestJSON:
+		return s, nil
+	}
+	return "", fmt.Errorf("invalid OUTPUT_FORMAT %q, expected %s or %s", s, outputFormatTAP, outputFormatGoTestJSON)
+}
+
+// outputParser turns the stdout of a test, which runs a test suite, into the
+// sub-results of the test
+type outputParser interface {
+	// parseLine parses the next line of the output
+	parseLine(line string)
+	// subResults returns the sub-results found in the output
+	subResults() []SubResult
+}
+
+// newOutputParser returns a parser for the output format or nil if there is
+// none
+func newOutputParser(format string) outputParser {
+	switch format {
+	case outputFormatTAP:
+		return &tapParser{last: time.Now()}
+	case outputFormatGoTestJSON:
+		return &goTestParser{output: map[string][]string{}}
+	}
+	return nil
+}
+
+// tapTestPoint matches a test point of TAP, e.g. "ok 1 - description" or
+// "not ok 2 description # SKIP reason"
+var tapTestPoint = regexp.MustCompile(`^(not )?ok\b\s*(\d*)\s*(?:-\s*)?(.*?)\s*(?:#\s*(?i:(skip|todo))\S*\s*(.*))?$`)
+
+// tapParser parses TAP. As TAP does not include timing, the duration of a
+// sub-result is the time since the previous one.
+type tapParser struct {
+	results []SubResult
+	last    time.Time
+	// diagnostics of the last test point, if it failed
+	diagnostics []string
+}
+
+func (p *tapParser) parseLine(line string) {
+	m := tapTestPoint.FindStringSubmatch(line)
+	if m == nil {
+		// Diagnostics, YAML blocks and subtests following a failed test
+		// point describe the failure
+		if len(p.results) > 0 && p.results[len(p.results)-1].TestResult == Fail &&
+			(strings.HasPrefix(line, "#") || strings.HasPrefix(line, " ")) {
+			p.diagnostics = append(p.diagnostics, line)
+			p.results[len(p.results)-1].Output = strings.Join(p.diagnostics, "\n")
+		}
+		return
+	}
+	now := time.Now()
+	r := SubResult{Name: m[3], TestResult: Pass, Duration: now.Sub(p.last)}
+	p.last = now
+	p.diagnostics = nil
+	if r.Name == "" {
+		r.Name = m[2]
+	}
+	if r.Name == "" {
+		r.Name = strconv.Itoa(len(p.results) + 1)
+	}
+	if m[1] != "" {
+		r.TestResult = Fail
+	}
+	switch strings.ToLower(m[4]) {
+	case "skip":
+		r.TestResult = Skip
+		r.Reason = m[5]
+	case "todo":
+		// Tests which are yet to be implemented are expected to fail
+		r.TestResult = Skip
+		r.Reason = strings.TrimSpace("TODO " + m[5])
+	}
+	p.results = append(p.results, r)
+}
+
+func (p *tapParser) subResults() []SubResult {
+	return p.results
+}
+
+// goTestEvent is a line of the output of go test -json, see go doc test2json
+type goTestEvent struct {
+	Action  string
+	Package string
+	Test    string
+	Elapsed float64
+	Output  string
+}
+
+// goTestParser parses the output of go test -json. Sub-results are named by
+// the package and the test, e.g. "example.com/pkg.TestFoo/subtest".
+type goTestParser struct {
+	results []SubResult
+	// output of the running tests by name
+	output map[string][]string
+}
+
+func (p *goTestParser) parseLine(line string) {
+	if !strings.HasPrefix(line, "{") {
+		return
+	}
+	var e goTestEvent
+	if err := json.Unmarshal([]byte(line), &e); err != nil || e.Test == "" {
+		return
+	}
+	name := e.Test
+	if e.Package != "" {
+		name = e.Package + "." + e.Test
+	}
+	r := SubResult{Name: name, Duration: time.Duration(e.Elapsed * float64(time.Second))}
+	switch e.Action {
+	case "output":
+		p.output[name] = append(p.output[name], strings.TrimRight(e.Output, "\n"))
+		return
+	case "pass":
+		r.TestResult = Pass
+	case "fail":
+		r.TestResult = Fail
+		r.Output = strings.Join(p.output[name], "\n")
+	case "skip":
+		r.TestResult = Skip
+		// The output apart from the === and --- lines of go test is
+		// logged by t.Skip
+		var reason []string
+		for _, o := range p.output[name] {
+			o = strings.TrimSpace(o)
+			if o != "" && !strings.HasPrefix(o, "===") && !strings.HasPrefix(o, "---") {
+				reason = append(reason, o)
+			}
+		}
+		r.Reason = strings.Join(reason, "; ")
+	default:
+		return
+	}
+	delete(p.output, name)
+	p.results = append(p.results, r)
+}
+
+func (p *goTestParser) subResults() []SubResult {
+	return p.results
+}
@@ -0,0 +1,94 @@
+package local
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseOutputFormat(t *testing.T) {
+	for _, s := range []string{"", "tap", " gotest-json "} {
+		if _, err := parseOutputFormat(s); err != nil {
+			t.Errorf("Unexpected error for %q: %v", s, err)
+		}
+	}
+	if _, err := parseOutputFormat("junit"); err == nil {
+		t.Errorf("Expected an error for an unknown format")
+	}
+}
+
+// stripDurations removes the durations of sub-results, which depend on when
+// the lines were parsed
+func stripDurations(results []SubResult) []SubResult {
+	for i := range results {
+		results[i].Duration = 0
+	}
+	return results
+}
+
+func TestTAPParser(t *testing.T) {
+	output := []string{
+		"TAP version 14",
+		"1..7",
+		"ok 1 - addition works",
+		"not ok 2 subtraction works",
+		"# (in test file math.bats, line 12)",
+		"#   `[ \"$result\" -eq 1 ]' failed",
+		"ok 3 # SKIP no network",
+		"not ok 4 - division # TODO not implemented",
+		"ok 5 - hash # in the name",
+		"not ok 6 - yaml",
+		"  ---",
+		"  message: timed out",
+		"  ...",
+		"some unrelated output",
+		"ok",
+	}
+	p := newOutputParser(outputFormatTAP)
+	for _, l := range output {
+		p.parseLine(l)
+	}
+	exp := []SubResult{
+		{Name: "addition works", TestResult: Pass},
+		{Name: "subtraction works", TestResult: Fail, Output: "# (in test file math.bats, line 12)\n#   `[ \"$result\" -eq 1 ]' failed"},
+		{Name: "3", TestResult: Skip, Reason: "no network"},
+		{Name: "division", TestResult: Skip, Reason: "TODO not implemented"},
+		{Name: "hash # in the name", TestResult: Pass},
+		{Name: "yaml", TestResult: Fail, Output: "  ---\n  message: timed out\n  ..."},
+		{Name: "7", TestResult: Pass},
+	}
+	if res := stripDurations(p.subResults()); !reflect.DeepEqual(res, exp) {
+		t.Fatalf("Expected %+v, got %+v", exp, res)
+	}
+}
+
+func TestGoTestParser(t *testing.T) {
+	output := []string{
+		`{"Action":"start","Package":"example.com/pkg"}`,
+		`{"Action":"run","Package":"example.com/pkg","Test":"TestPass"}`,
+		`{"Action":"output","Package":"example.com/pkg","Test":"TestPass","Output":"=== RUN   TestPass\n"}`,
+		`{"Action":"output","Package":"example.com/pkg","Test":"TestPass","Output":"--- PASS: TestPass (0.50s)\n"}`,
+		`{"Action":"pass","Package":"example.com/pkg","Test":"TestPass","Elapsed":0.5}`,
+		`{"Action":"run","Package":"example.com/pkg","Test":"TestFail/sub"}`,
+		`{"Action":"output","Package":"example.com/pkg","Test":"TestFail/sub","Output":"    pkg_test.go:10: got 1, want 2\n"}`,
+		`{"Action":"output","Package":"example.com/pkg","Test":"TestFail/sub","Output":"    --- FAIL: TestFail/sub (0.00s)\n"}`,
+		`{"Action":"fail","Package":"example.com/pkg","Test":"TestFail/sub","Elapsed":0}`,
+		`{"Action":"output","Package":"example.com/pkg","Test":"TestSkip","Output":"=== RUN   TestSkip\n"}`,
+		`{"Action":"output","Package":"example.com/pkg","Test":"TestSkip","Output":"    pkg_test.go:20: needs root\n"}`,
+		`{"Action":"output","Package":"example.com/pkg","Test":"TestSkip","Output":"--- SKIP: TestSkip (0.00s)\n"}`,
+		`{"Action":"skip","Package":"example.com/pkg","Test":"TestSkip","Elapsed":0}`,
+		`not json`,
+		`{"Action":"fail","Package":"example.com/pkg","Elapsed":0.6}`,
+	}
+	p := newOutputParser(outputFormatGoTestJSON)
+	for _, l := range output {
+		p.parseLine(l)
+	}
+	exp := []SubResult{
+		{Name: "example.com/pkg.TestPass", TestResult: Pass, Duration: 500000000},
+		{Name: "example.com/pkg.TestFail/sub", TestResult: Fail, Output: "    pkg_test.go:10: got 1, want 2\n    --- FAIL: TestFail/sub (0.00s)"},
+		{Name: "example.com/pkg.TestSkip", TestResult: Skip, Reason: "pkg_test.go:20: needs root"},
+	}
+	if res := p.subResults(); !reflect.DeepEqual(res, exp) {
+		t.Fatalf("Expected %+v, got %+v", exp, res)
+	}
+}
@@ -2,21 +2,40 @@ package local
 
 import (
 	"bufio"
+	"bytes"
 	"fmt"
+	"io"
 	"os"
+	"path/filepath"
 	"reflect"
 	"strconv"
 	"strings"
+	"time"
 )
 
 // Tags are the permitted tags within a test file
 type Tags struct {
-	Name    string `rt:"NAME"`
-	Summary string `rt:"SUMMARY"`
-	Author  string `rt:"AUTHOR,allowmultiple"`
-	Labels  string `rt:"LABELS"`
-	Repeat  int    `rt:"REPEAT"`
-	Issue   string `rt:"ISSUE,allowmultiple"`
+	Name      string        `rt:"NAME"`
+	Summary   string        `rt:"SUMMARY"`
+	Author    string        `rt:"AUTHOR,allowmultiple"`
+	Labels    string        `rt:"LABELS"`
+	Repeat    string        `rt:"REPEAT"`
+	Issue     string        `rt:"ISSUE,allowmultiple"`
+	Timeout   time.Duration `rt:"TIMEOUT"`
+	Retries   int           `rt:"RETRIES"`
+	Env       string        `rt:"ENV,allowmultiple"`
+	Depends   string        `rt:"DEPENDS,allowmultiple"`
+	Resources string        `rt:"RESOURCES,allowmultiple"`
+	Exclusive bool          `rt:"EXCLUSIVE"`
+	WorkDir   string        `rt:"WORKDIR"`
+	// MemoryLimit and CPULimit are only applied with per-test cgroups
+	MemoryLimit string `rt:"MEMORY_LIMIT"`
+	CPULimit    string `rt:"CPU_LIMIT"`
+	Sandbox     string `rt:"SANDBOX"`
+	Network     string `rt:"NETWORK"`
+	// OutputFormat is the format of the stdout of a test which runs a
+	// test suite, which is parsed into sub-results
+	OutputFormat string `rt:"OUTPUT_FORMAT"`
 }
 
 const allowMultiple = "allowmultiple"
@@ -37,7 +56,8 @@ func multiplesAllowed(s string) bool {
 	return false
 }
 
-// ParseTags reads the provided file and returns all discovered tags or an error
+// ParseTags reads the provided file and returns all discovered tags or an error,
+// e.g. if the value of a tag is invalid
 func ParseTags(file string) (*Tags, error) {
 	f, err := os.Open(file)
 	if err != nil {
@@ -65,10 +85,30 @@ func ParseTags(file string) (*Tags, error) {
 						vt := reflect.ValueOf(tags).Elem()
 						v := vt.Field(i)
 						switch v.Kind() {
+						case reflect.Int64:
+							if v.Type() != reflect.TypeOf(time.Duration(0)) {
+								continue
+							}
+							d, err := parseDuration(tagValue)
+							if err != nil {
+								return nil, fmt.Errorf("%s: invalid %s %q, expected a duration such as 90s or 5m", file, tagName, tagValue)
+							}
+							v.SetInt(int64(d))
+						case reflect.Bool:
+							// A flag without a value is set
+							if tagValue == "" {
+								v.SetBool(true)
+								continue
+							}
+							vb, err := strconv.ParseBool(tagValue)
+							if err != nil {
+								return nil, fmt.Errorf("%s: invalid %s %q, expected true or false", file, tagName, tagValue)
+							}
+							v.SetBool(vb)
 						case reflect.Int:
 							vi, err := strconv.Atoi(tagValue)
 							if err != nil {
-								continue
+								return nil, fmt.Errorf("%s: invalid %s %q, expected a number", file, tagName, tagValue)
 							}
 							v.SetInt(int64(vi))
 						case reflect.String:
@@ -92,3 +132,85 @@ func ParseTags(file string) (*Tags, error) {
 	}
 	return tags, nil
 }
+
+// MetaFileExt is the extension of the file next to a script which contains
+// its tags instead of the script itself, e.g. test.meta for a test binary
+const MetaFileExt = ".meta"
+
+// scriptTags returns the tags of a script. They are read from the meta file
+// of the script if there is one. Binaries without one have no tags.
+func scriptTags(script string) (*Tags, error) {
+	if script == "" {
+		return ParseTags(script)
+	}
+	meta := strings.TrimSuffix(script, filepath.Ext(script)) + MetaFileExt
+	if _, err := os.Stat(meta); err == nil {
+		return ParseTags(meta)
+	}
+	binary, err := isBinary(script)
+	if err != nil {
+		return nil, err
+	}
+	if binary {
+		return &Tags{}, nil
+	}
+	return ParseTags(script)
+}
+
+// isBinary returns true if the start of file contains a NUL byte, which text
+// files do not
+func isBinary(file string) (bool, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return false, err
+	}
+	defer func() { _ = f.Close() }()
+
+	buf := make([]byte, 512)
+	n, err := io.ReadFull(f, buf)
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		return false, err
+	}
+	return bytes.IndexByte(buf[:n], 0) >= 0, nil
+}
+
+// parseDuration parses a duration such as "90s" or "1h30m". A plain number is
+// interpreted as seconds.
+func parseDuration(s string) (time.Duration, error) {
+	if n, err := strconv.Atoi(s); err == nil {
+		return time.Duration(n) * time.Second, nil
+	}
+	return time.ParseDuration(s)
+}
+
+// parseRepeat parses the value of a REPEAT tag. It contains an optional number
+// of iterations and any number of <label>:<number> entries, which apply if the
+// label is set, e.g. "1 release:20 soak:200".
+func parseRepeat(s string) (int, map[string]int, error) {
+	count := 0
+	labelCounts := map[string]int{}
+	for _, f := range strings.Fields(s) {
+		parts := strings.SplitN(f, ":", 2)
+		n, err := strconv.Atoi(parts[len(parts)-1])
+		if err != nil || n < 0 {
+			return 0, nil, fmt.Errorf("invalid REPEAT entry: %s", f)
+		}
+		if len(parts) == 1 {
+			count = n
+			continue
+		}
+		if parts[0] == "" {
+			return 0, nil, fmt.Errorf("invalid REPEAT entry: %s", f)
+		}
+		labelCounts[parts[0]] = n
+	}
+	return count, labelCounts, nil
+}
+
+// splitList splits a space or comma separated list, as used by tags such as
+// DEPENDS and RESOURCES
+func splitList(s string) []string {
+	return strings.FieldsFunc(s, func(r rune) bool {
+		return r == ',' || r == ' ' || r == '\t'
+	})
+}
@@ -1,12 +1,22 @@
 package local
 
-import "testing"
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
 
 func TestParseTags(t *testing.T) {
 	eSummary := "A Test"
 	eAuthor := "Dave Tucker <dt@docker.com> Rolf Neugebauer <rolf.neugebauer@docker.com>"
 	eLabels := "foo, bar, !baz"
-	eRepeat := 5
+	eRepeat := "5 release:20"
+	eTimeout := 90 * time.Second
+	eRetries := 2
+	eResources := "docker, port:8080"
 	eIssue := "https://github.com/linuxkit/rtf/issues/1 https://github.com/linuxkit/rtf/issues/2"
 
 	tags, err := ParseTags("testdata/test.sh")
@@ -24,11 +34,42 @@ func TestParseTags(t *testing.T) {
 		t.Fatalf("\nExpected: %s \nGot: %s\n", eLabels, tags.Labels)
 	}
 	if eRepeat != tags.Repeat {
-		t.Fatalf("\nExpected: %d \nGot: %d\n", eRepeat, tags.Repeat)
+		t.Fatalf("\nExpected: %s \nGot: %s\n", eRepeat, tags.Repeat)
 	}
 	if eIssue != tags.Issue {
 		t.Fatalf("\nExpected: %s \nGot: %s\n", eIssue, tags.Issue)
 	}
+	if eTimeout != tags.Timeout {
+		t.Fatalf("\nExpected: %s \nGot: %s\n", eTimeout, tags.Timeout)
+	}
+	if eRetries != tags.Retries {
+		t.Fatalf("\nExpected: %d \nGot: %d\n", eRetries, tags.Retries)
+	}
+	if eResources != tags.Resources {
+		t.Fatalf("\nExpected: %s \nGot: %s\n", eResources, tags.Resources)
+	}
+	if !tags.Exclusive {
+		t.Fatalf("\nExpected: EXCLUSIVE to be set\n")
+	}
+}
+
+func TestParseDuration(t *testing.T) {
+	for _, tt := range []struct {
+		in  string
+		out time.Duration
+	}{
+		{"30", 30 * time.Second},
+		{"90s", 90 * time.Second},
+		{"1h30m", 90 * time.Minute},
+	} {
+		d, err := parseDuration(tt.in)
+		if err != nil {
+			t.Fatalf("Error parsing %s: %v", tt.in, err)
+		}
+		if d != tt.out {
+			t.Fatalf("\nExpected: %s \nGot: %s\n", tt.out, d)
+		}
+	}
 }
 
 func TestParseBadTags(t *testing.T) {
@@ -40,3 +81,63 @@ func TestParseBadTags(t *testing.T) {
 		t.Fatalf("Wrong error message")
 	}
 }
+
+func TestParseRepeat(t *testing.T) {
+	for _, tt := range []struct {
+		in          string
+		count       int
+		labelCounts map[string]int
+		err         bool
+	}{
+		{"", 0, map[string]int{}, false},
+		{"5", 5, map[string]int{}, false},
+		{"1 release:20 soak:200", 1, map[string]int{"release": 20, "soak": 200}, false},
+		{"release:20", 0, map[string]int{"release": 20}, false},
+		{"release:many", 0, nil, true},
+		{":20", 0, nil, true},
+		{"-1", 0, nil, true},
+	} {
+		count, labelCounts, err := parseRepeat(tt.in)
+		if tt.err {
+			if err == nil {
+				t.Fatalf("Expected an error parsing %q", tt.in)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("Error parsing %q: %v", tt.in, err)
+		}
+		if count != tt.count || !reflect.DeepEqual(labelCounts, tt.labelCounts) {
+			t.Fatalf("\nExpected: %d %v\nGot: %d %v\n", tt.count, tt.labelCounts, count, labelCounts)
+		}
+	}
+}
+
+func TestParseInvalidTagValues(t *testing.T) {
+	dir, err := ioutil.TempDir("", "rtf")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = os.RemoveAll(dir) }()
+
+	for _, tt := range []struct {
+		tag string
+		err string
+	}{
+		{"TIMEOUT: 5 minutes", `invalid TIMEOUT "5 minutes", expected a duration such as 90s or 5m`},
+		{"RETRIES: two", `invalid RETRIES "two", expected a number`},
+		{"EXCLUSIVE: maybe", `invalid EXCLUSIVE "maybe", expected true or false`},
+	} {
+		f := filepath.Join(dir, "test.sh")
+		if err := ioutil.WriteFile(f, []byte("#!/bin/sh\n# "+tt.tag+"\n"), 0644); err != nil {
+			t.Fatal(err)
+		}
+		_, err := ParseTags(f)
+		if err == nil {
+			t.Fatalf("Expected an error for %q", tt.tag)
+		}
+		if expected := f + ": " + tt.err; err.Error() != expected {
+			t.Fatalf("\nExpected: %s \nGot: %s\n", expected, err)
+		}
+	}
+}
@@ -47,18 +47,28 @@ func (p *Project) SetShard(shard, totalShards int) error {
 	return nil
 }
 
-// Run runs all child groups and tests, limited by the provided shards
+// Run runs all child groups and tests, limited by the provided shards. The
+// tests which the selected tests depend on are always run as well.
 func (p *Project) Run(config RunConfig) ([]Result, error) {
-	// if we are sharded, walk the tree to create a list of the tests to run
+	// walk the tree to create a list of the tests to run
+	infos := p.List(config)
+	restrictToTests := map[string]bool{}
+	for _, info := range infos {
+		if info.TestResult != Skip {
+			restrictToTests[info.Name] = true
+		}
+	}
+	if added := p.addPrerequisites(restrictToTests); len(added) > 0 {
+		// The prerequisites are run even if they do not match the test
+		// pattern, which still applies to all other tests
+		config.prerequisites = added
+		config.Logger.Log(logger.LevelInfo, fmt.Sprintf("adding prerequisites %v", added))
+	}
 	if p.totalShards <= 1 {
 		return p.Group.Run(config)
 	}
 
-	infos := p.List(config)
-	config.restrictToTests = map[string]bool{}
-	for _, info := range infos {
-		config.restrictToTests[info.Name] = true
-	}
+	config.restrictToTests = restrictToTests
 	config.Logger.Log(logger.LevelInfo, fmt.Sprintf("restricting tests to %v", config.restrictToTests))
 
 	return p.Group.Run(config)
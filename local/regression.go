@@ -0,0 +1,169 @@
+package local
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// MetricChange classifies the change of a metric relative to a baseline
+type MetricChange int
+
+const (
+	// Unchanged metrics changed by no more than their threshold
+	Unchanged MetricChange = iota
+	// Improved metrics changed beyond their threshold in their direction
+	Improved
+	// Regressed metrics changed beyond their threshold against their
+	// direction
+	Regressed
+	// Changed metrics changed beyond their threshold but have no direction
+	Changed
+)
+
+// MetricChangeNames provides a mapping of metric changes to their names
+var MetricChangeNames = map[MetricChange]string{
+	Unchanged: "unchanged",
+	Improved:  "improved",
+	Regressed: "regressed",
+	Changed:   "changed",
+}
+
+// CompareMetric classifies the change of m relative to base, given the
+// threshold in percent. The direction of base is used if m has none.
+func CompareMetric(base, m Metric, threshold float64) MetricChange {
+	change, ok := m.Change(base)
+	if !ok {
+		// Any change from zero is beyond the threshold
+		if m.Value == base.Value {
+			return Unchanged
+		}
+		change = m.Value - base.Value
+	} else if change >= -threshold && change <= threshold {
+		return Unchanged
+	}
+	direction := m.Direction
+	if direction == "" {
+		direction = base.Direction
+	}
+	if direction == "" {
+		return Changed
+	}
+	if direction == HigherIsBetter && change > 0 || direction == LowerIsBetter && change < 0 {
+		return Improved
+	}
+	return Regressed
+}
+
+// BenchmarkMetricName is the name of the metric of the RT_BENCHMARK_RESULT of
+// a test, e.g. in threshold files
+const BenchmarkMetricName = "benchmark"
+
+// BenchmarkMetric returns the RT_BENCHMARK_RESULT of a test as a metric, if
+// it starts with a number
+func BenchmarkMetric(r Result) (Metric, bool) {
+	fields := strings.Fields(r.BenchmarkResult)
+	if len(fields) == 0 {
+		return Metric{}, false
+	}
+	v, err := strconv.ParseFloat(fields[0], 64)
+	if err != nil {
+		return Metric{}, false
+	}
+	return Metric{Value: v, Unit: strings.Join(fields[1:], " ")}, true
+}
+
+// thresholdKey identifies the metric of a test a threshold applies to. An
+// empty test matches the metric of all tests.
+type thresholdKey struct {
+	test   string
+	metric string
+}
+
+// Thresholds are the percentages by which metrics may change before they are
+// considered to be improved or regressed
+type Thresholds struct {
+	def        float64
+	hasDefault bool
+	metrics    map[thresholdKey]float64
+}
+
+// SetDefault sets the threshold of metrics without a specific one
+func (t *Thresholds) SetDefault(threshold float64) {
+	t.def = threshold
+	t.hasDefault = true
+}
+
+// Lookup returns the threshold for a metric of a test. A threshold for the
+// metric of the test takes precedence over one for the metric of all tests,
+// which takes precedence over the default. It returns false if there is no
+// threshold for the metric.
+func (t *Thresholds) Lookup(test, metric string) (float64, bool) {
+	if th, ok := t.metrics[thresholdKey{test, metric}]; ok {
+		return th, true
+	}
+	if th, ok := t.metrics[thresholdKey{"", metric}]; ok {
+		return th, true
+	}
+	return t.def, t.hasDefault
+}
+
+// Listed returns true if the threshold file has a threshold for a metric of
+// a test, either for the test or for the metric of all tests
+func (t *Thresholds) Listed(test, metric string) bool {
+	_, ok := t.metrics[thresholdKey{test, metric}]
+	if !ok {
+		_, ok = t.metrics[thresholdKey{"", metric}]
+	}
+	return ok
+}
+
+// ParseThreshold parses a threshold in percent, with or without a trailing %
+func ParseThreshold(s string) (float64, error) {
+	th, err := strconv.ParseFloat(strings.TrimSuffix(strings.TrimSpace(s), "%"), 64)
+	if err != nil || th < 0 {
+		return 0, fmt.Errorf("invalid threshold %q, expected a percentage such as 10%%", s)
+	}
+	return th, nil
+}
+
+// ReadThresholdFile reads the thresholds for metrics from a file. Each line
+// is either "metric threshold", for the metric of all tests, or "test metric
+// threshold". Empty lines and lines starting with # are ignored.
+func ReadThresholdFile(path string) (*Thresholds, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = f.Close() }()
+
+	t := &Thresholds{metrics: map[thresholdKey]float64{}}
+	scanner := bufio.NewScanner(f)
+	for n := 1; scanner.Scan(); n++ {
+		l := strings.TrimSpace(scanner.Text())
+		if l == "" || strings.HasPrefix(l, "#") {
+			continue
+		}
+		fields := strings.Fields(l)
+		var key thresholdKey
+		switch len(fields) {
+		case 2:
+			key.metric = fields[0]
+		case 3:
+			key.test, key.metric = fields[0], fields[1]
+		default:
+			return nil, fmt.Errorf("%s:%d: expected [test] metric threshold", path, n)
+		}
+		th, err := ParseThreshold(fields[len(fields)-1])
+		if err != nil {
+			return nil, fmt.Errorf("%s:%d: %v", path, n, err)
+		}
+		t.metrics[key] = th
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return t, nil
+}
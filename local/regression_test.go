@@ -0,0 +1,113 @@
+package local
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestCompareMetric(t *testing.T) {
+	tests := []struct {
+		base, m   Metric
+		threshold float64
+		exp       MetricChange
+	}{
+		{Metric{Value: 100, Direction: HigherIsBetter}, Metric{Value: 105, Direction: HigherIsBetter}, 10, Unchanged},
+		{Metric{Value: 100, Direction: HigherIsBetter}, Metric{Value: 90, Direction: HigherIsBetter}, 10, Unchanged},
+		{Metric{Value: 100, Direction: HigherIsBetter}, Metric{Value: 115, Direction: HigherIsBetter}, 10, Improved},
+		{Metric{Value: 100, Direction: HigherIsBetter}, Metric{Value: 85, Direction: HigherIsBetter}, 10, Regressed},
+		{Metric{Value: 100, Direction: LowerIsBetter}, Metric{Value: 115, Direction: LowerIsBetter}, 10, Regressed},
+		{Metric{Value: 100, Direction: LowerIsBetter}, Metric{Value: 85, Direction: LowerIsBetter}, 10, Improved},
+		// The direction of the baseline is used if the metric has none
+		{Metric{Value: 100, Direction: LowerIsBetter}, Metric{Value: 115}, 10, Regressed},
+		// Metrics without a direction are only marked as changed
+		{Metric{Value: 100}, Metric{Value: 105}, 10, Unchanged},
+		{Metric{Value: 100}, Metric{Value: 200}, 10, Changed},
+		{Metric{Value: 100}, Metric{Value: 50}, 10, Changed},
+		{Metric{Value: 100}, Metric{Value: 100}, 0, Unchanged},
+		{Metric{Value: 0, Direction: LowerIsBetter}, Metric{Value: 0}, 0, Unchanged},
+		{Metric{Value: 0, Direction: LowerIsBetter}, Metric{Value: 1}, 10, Regressed},
+	}
+	for _, tc := range tests {
+		if c := CompareMetric(tc.base, tc.m, tc.threshold); c != tc.exp {
+			t.Errorf("Expected %s for %+v -> %+v with threshold %g%%, got %s", MetricChangeNames[tc.exp], tc.base, tc.m, tc.threshold, MetricChangeNames[c])
+		}
+	}
+}
+
+func TestBenchmarkMetric(t *testing.T) {
+	for s, exp := range map[string]Metric{"12.5": {Value: 12.5}, " 3 ms ": {Value: 3, Unit: "ms"}} {
+		m, ok := BenchmarkMetric(Result{BenchmarkResult: s})
+		if !ok || m != exp {
+			t.Errorf("Expected %+v for %q, got %+v %v", exp, s, m, ok)
+		}
+	}
+	for _, s := range []string{"", "fast"} {
+		if m, ok := BenchmarkMetric(Result{BenchmarkResult: s}); ok {
+			t.Errorf("Expected no metric for %q, got %+v", s, m)
+		}
+	}
+}
+
+func TestParseThreshold(t *testing.T) {
+	for s, exp := range map[string]float64{"10%": 10, "2.5": 2.5, " 0% ": 0} {
+		th, err := ParseThreshold(s)
+		if err != nil || th != exp {
+			t.Errorf("Expected %g for %q, got %g %v", exp, s, th, err)
+		}
+	}
+	for _, s := range []string{"", "%", "ten", "-5%"} {
+		if _, err := ParseThreshold(s); err == nil {
+			t.Errorf("Expected an error for %q", s)
+		}
+	}
+}
+
+func TestReadThresholdFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "rtf")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = os.RemoveAll(dir) }()
+
+	path := filepath.Join(dir, "thresholds")
+	content := `# Latency is noisy
+latency 20%
+
+foo.bench latency 5%
+throughput 10
+`
+	if err := ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	th, err := ReadThresholdFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lookup := func(test, metric string, exp float64, expOK bool) {
+		v, ok := th.Lookup(test, metric)
+		if v != exp || ok != expOK {
+			t.Errorf("Expected %g %v for %s %s, got %g %v", exp, expOK, test, metric, v, ok)
+		}
+	}
+	lookup("foo.bench", "latency", 5, true)
+	lookup("bar.bench", "latency", 20, true)
+	lookup("foo.bench", "throughput", 10, true)
+	lookup("foo.bench", "cpu", 0, false)
+	if !th.Listed("foo.bench", "latency") || !th.Listed("bar.bench", "throughput") || th.Listed("foo.bench", "cpu") {
+		t.Errorf("Unexpected metrics listed in the threshold file")
+	}
+	th.SetDefault(15)
+	lookup("foo.bench", "cpu", 15, true)
+	lookup("foo.bench", "latency", 5, true)
+
+	for _, c := range []string{"latency\n", "a b c 10%\n", "latency fast\n"} {
+		if err := ioutil.WriteFile(path, []byte(c), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := ReadThresholdFile(path); err == nil {
+			t.Errorf("Expected an error for %q", c)
+		}
+	}
+}
@@ -0,0 +1,217 @@
+package local
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// MetricDirection tells whether higher or lower values of a metric are better
+type MetricDirection string
+
+const (
+	// HigherIsBetter is the direction of metrics such as throughput
+	HigherIsBetter MetricDirection = "higher-is-better"
+	// LowerIsBetter is the direction of metrics such as latency
+	LowerIsBetter MetricDirection = "lower-is-better"
+)
+
+// Metric is a named numeric value reported by a test
+type Metric struct {
+	Value     float64         `json:"value"`
+	Unit      string          `json:"unit,omitempty"`
+	Direction MetricDirection `json:"direction,omitempty"`
+}
+
+// String returns the value of the metric together with its unit
+func (m Metric) String() string {
+	s := fmt.Sprintf("%g", m.Value)
+	if m.Unit != "" {
+		s = s + " " + m.Unit
+	}
+	return s
+}
+
+// Change returns the change of the metric relative to base in percent. It
+// returns false if there is no meaningful change, as base is zero.
+func (m Metric) Change(base Metric) (float64, bool) {
+	if base.Value == 0 {
+		return 0, false
+	}
+	return (m.Value - base.Value) / math.Abs(base.Value) * 100, true
+}
+
+// parseMetricDirection parses the direction of a metric. "higher" and
+// "lower" are accepted as short forms.
+func parseMetricDirection(s string) (MetricDirection, error) {
+	switch strings.ToLower(s) {
+	case "":
+		return "", nil
+	case "higher", string(HigherIsBetter):
+		return HigherIsBetter, nil
+	case "lower", string(LowerIsBetter):
+		return LowerIsBetter, nil
+	}
+	return "", fmt.Errorf("unknown direction %q, expected higher-is-better or lower-is-better", s)
+}
+
+// parseMetricLine parses the remainder of a RT_METRIC line on stdout of the
+// form "name=value [unit] [higher|lower-is-better]"
+func parseMetricLine(s string) (string, Metric, error) {
+	fields := strings.Fields(s)
+	if len(fields) == 0 {
+		return "", Metric{}, fmt.Errorf("empty metric")
+	}
+	kv := strings.SplitN(fields[0], "=", 2)
+	if len(kv) != 2 || kv[0] == "" {
+		return "", Metric{}, fmt.Errorf("invalid metric %q, expected name=value", fields[0])
+	}
+	v, err := strconv.ParseFloat(kv[1], 64)
+	if err != nil {
+		return "", Metric{}, fmt.Errorf("invalid value of metric %s: %v", kv[0], err)
+	}
+	m := Metric{Value: v}
+	rest := fields[1:]
+	if len(rest) > 0 {
+		if d, err := parseMetricDirection(rest[len(rest)-1]); err == nil {
+			m.Direction = d
+			rest = rest[:len(rest)-1]
+		}
+	}
+	m.Unit = strings.Join(rest, " ")
+	return kv[0], m, nil
+}
+
+// Link is a named URL reported by a test, e.g. to a dashboard
+type Link struct {
+	Name string `json:"name,omitempty"`
+	URL  string `json:"url"`
+}
+
+// SubResult is the result of a part of a test, e.g. a single case of a test
+// which runs a whole test suite. Sub-results do not change the result of the
+// test itself.
+type SubResult struct {
+	Name       string        `json:"name"`
+	TestResult TestResult    `json:"result"`
+	Duration   time.Duration `json:"duration,omitempty"`
+	Reason     string        `json:"reason,omitempty"`
+	// Output describes the failure of a sub-result parsed from the output
+	// of a test
+	Output string `json:"output,omitempty"`
+}
+
+// resultFileEntry is a single line of the file tests write to RT_RESULT_FILE
+type resultFileEntry struct {
+	Type  string  `json:"type"`
+	Name  string  `json:"name"`
+	Value float64 `json:"value"`
+	Unit  string  `json:"unit"`
+	Text  string  `json:"text"`
+	URL   string  `json:"url"`
+	// Direction of a metric, higher-is-better or lower-is-better
+	Direction string `json:"direction"`
+	// Result and Reason of a sub-result, Duration is in seconds
+	Result   string  `json:"result"`
+	Duration float64 `json:"duration"`
+	Reason   string  `json:"reason"`
+}
+
+// resultFile is the data reported by a test in its result file
+type resultFile struct {
+	metrics    map[string]Metric
+	notes      []string
+	warnings   []string
+	links      []Link
+	subResults []SubResult
+}
+
+// parseResultFile parses the JSON lines a test wrote to its result file. A
+// missing file is not an error. Invalid lines are reported as warnings, so
+// that a broken result file does not hide the result of the test.
+func parseResultFile(path string) (*resultFile, error) {
+	rf := &resultFile{}
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return rf, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = f.Close() }()
+
+	scanner := bufio.NewScanner(f)
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+		if err := rf.add(line); err != nil {
+			rf.warnings = append(rf.warnings, fmt.Sprintf("result file line %d: %v", n, err))
+		}
+	}
+	return rf, scanner.Err()
+}
+
+// add adds a single line of the result file
+func (rf *resultFile) add(line string) error {
+	var e resultFileEntry
+	if err := json.Unmarshal([]byte(line), &e); err != nil {
+		return err
+	}
+	switch e.Type {
+	case "metric":
+		if e.Name == "" {
+			return fmt.Errorf("metric without a name")
+		}
+		if rf.metrics == nil {
+			rf.metrics = map[string]Metric{}
+		}
+		d, err := parseMetricDirection(e.Direction)
+		if err != nil {
+			return err
+		}
+		rf.metrics[e.Name] = Metric{Value: e.Value, Unit: e.Unit, Direction: d}
+	case "note":
+		rf.notes = append(rf.notes, e.Text)
+	case "warning":
+		rf.warnings = append(rf.warnings, e.Text)
+	case "link":
+		if e.URL == "" {
+			return fmt.Errorf("link without a url")
+		}
+		rf.links = append(rf.links, Link{Name: e.Name, URL: e.URL})
+	case "result":
+		if e.Name == "" {
+			return fmt.Errorf("result without a name")
+		}
+		res, err := parseTestResult(e.Result)
+		if err != nil {
+			return err
+		}
+		rf.subResults = append(rf.subResults, SubResult{
+			Name:       e.Name,
+			TestResult: res,
+			Duration:   time.Duration(e.Duration * float64(time.Second)),
+			Reason:     e.Reason,
+		})
+	default:
+		return fmt.Errorf("unknown type %q", e.Type)
+	}
+	return nil
+}
+
+// parseTestResult parses the name of a test result, ignoring case
+func parseTestResult(s string) (TestResult, error) {
+	for r, name := range TestResultNames {
+		if strings.EqualFold(s, name) {
+			return r, nil
+		}
+	}
+	return Fail, fmt.Errorf("unknown result %q", s)
+}
@@ -0,0 +1,111 @@
+package local
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestParseResultFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "rtf")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = os.RemoveAll(dir) }()
+
+	path := filepath.Join(dir, "result.jsonl")
+	rf, err := parseResultFile(path)
+	if err != nil {
+		t.Fatalf("A missing result file should not be an error: %v", err)
+	}
+	if rf.metrics != nil || rf.warnings != nil {
+		t.Fatalf("Expected an empty result for a missing file, got %+v", rf)
+	}
+
+	content := `{"type":"metric","name":"throughput","value":12.5,"unit":"MB/s","direction":"higher-is-better"}
+{"type":"metric","name":"latency","value":3,"direction":"sideways"}
+{"type":"note","text":"a note"}
+
+{"type":"link","name":"dashboard","url":"https://example.com"}
+{"type":"result","name":"case1","result":"pass","duration":1.5}
+{"type":"result","name":"case2","result":"Skip","reason":"not supported"}
+{"type":"unknown"}
+not json
+{"type":"warning","text":"a warning"}
+`
+	if err := ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	rf, err = parseResultFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	exp := &resultFile{
+		metrics: map[string]Metric{"throughput": {Value: 12.5, Unit: "MB/s", Direction: HigherIsBetter}},
+		notes:   []string{"a note"},
+		warnings: []string{
+			`result file line 2: unknown direction "sideways", expected higher-is-better or lower-is-better`,
+			`result file line 8: unknown type "unknown"`,
+			"result file line 9: invalid character 'o' in literal null (expecting 'u')",
+			"a warning",
+		},
+		links: []Link{{Name: "dashboard", URL: "https://example.com"}},
+		subResults: []SubResult{
+			{Name: "case1", TestResult: Pass, Duration: 1500 * time.Millisecond},
+			{Name: "case2", TestResult: Skip, Reason: "not supported"},
+		},
+	}
+	if !reflect.DeepEqual(rf, exp) {
+		t.Fatalf("Expected %+v, got %+v", exp, rf)
+	}
+}
+
+func TestParseMetricLine(t *testing.T) {
+	tests := []struct {
+		line   string
+		name   string
+		metric Metric
+		err    bool
+	}{
+		{line: " throughput=12.5", name: "throughput", metric: Metric{Value: 12.5}},
+		{line: " throughput=12.5 MB/s", name: "throughput", metric: Metric{Value: 12.5, Unit: "MB/s"}},
+		{line: " throughput=12.5 MB/s higher-is-better", name: "throughput", metric: Metric{Value: 12.5, Unit: "MB/s", Direction: HigherIsBetter}},
+		{line: "p99=1e3 us lower", name: "p99", metric: Metric{Value: 1000, Unit: "us", Direction: LowerIsBetter}},
+		{line: "cpu=-2 cpu seconds", name: "cpu", metric: Metric{Value: -2, Unit: "cpu seconds"}},
+		{line: "", err: true},
+		{line: "throughput", err: true},
+		{line: "=12", err: true},
+		{line: "throughput=fast", err: true},
+	}
+	for _, tc := range tests {
+		name, m, err := parseMetricLine(tc.line)
+		if tc.err {
+			if err == nil {
+				t.Errorf("Expected an error for %q", tc.line)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("Unexpected error for %q: %v", tc.line, err)
+			continue
+		}
+		if name != tc.name || m != tc.metric {
+			t.Errorf("Expected %s=%+v for %q, got %s=%+v", tc.name, tc.metric, tc.line, name, m)
+		}
+	}
+}
+
+func TestMetricChange(t *testing.T) {
+	if c, ok := (Metric{Value: 15}).Change(Metric{Value: 10}); !ok || c != 50 {
+		t.Errorf("Expected a change of 50%%, got %v %v", c, ok)
+	}
+	if c, ok := (Metric{Value: -5}).Change(Metric{Value: -10}); !ok || c != 50 {
+		t.Errorf("Expected a change of 50%%, got %v %v", c, ok)
+	}
+	if _, ok := (Metric{Value: 5}).Change(Metric{Value: 0}); ok {
+		t.Errorf("Expected no change relative to zero")
+	}
+}
@@ -0,0 +1,58 @@
+package local
+
+import (
+	"fmt"
+	"strings"
+)
+
+// sandboxInitName is the name rtf is re-executed with to set up the sandbox
+// of a test before running the test script
+const sandboxInitName = "rtf-sandbox-init"
+
+// sandboxEnv is the environment variable passing the sandboxConfig to the
+// sandbox init process. It is removed before the test script is run.
+const sandboxEnv = "_RTF_SANDBOX"
+
+// sandboxConfig describes the sandbox a test script is run in
+type sandboxConfig struct {
+	// ReadOnly are directories which are only visible read-only
+	ReadOnly []string `json:"read_only"`
+	// Writable are directories which remain writable, even if they are
+	// below /tmp or a ReadOnly directory
+	Writable []string `json:"writable"`
+	// PrivateNetwork runs the script in a network namespace with only a
+	// loopback interface
+	PrivateNetwork bool `json:"private_network"`
+}
+
+const (
+	sandboxDefault = iota
+	sandboxOn
+	sandboxOff
+)
+
+// parseSandbox parses the value of a SANDBOX tag, which overrides the --sandbox
+// option for a test
+func parseSandbox(s string) (int, error) {
+	switch strings.TrimSpace(s) {
+	case "":
+		return sandboxDefault, nil
+	case "on":
+		return sandboxOn, nil
+	case "off":
+		return sandboxOff, nil
+	}
+	return sandboxDefault, fmt.Errorf("invalid SANDBOX %q, expected on or off", s)
+}
+
+// parseNetwork parses the value of a NETWORK tag and returns true if the test
+// should only have a loopback interface when run in a sandbox
+func parseNetwork(s string) (bool, error) {
+	switch strings.TrimSpace(s) {
+	case "", "host":
+		return false, nil
+	case "none":
+		return true, nil
+	}
+	return false, fmt.Errorf("invalid NETWORK %q, expected host or none", s)
+}
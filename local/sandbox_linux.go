@@ -0,0 +1,229 @@
+package local
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"os/signal"
+	"path/filepath"
+	"syscall"
+	"unsafe"
+)
+
+// sandboxSetupFailed is the exit code of the sandbox init process if the
+// sandbox could not be set up
+const sandboxSetupFailed = 125
+
+// sandboxMainCalled is set once SandboxMain was called, which is needed to
+// set up the sandbox in the re-executed program
+var sandboxMainCalled bool
+
+// SandboxMain runs the sandbox init process if the program was re-executed to
+// set up the sandbox of a test, and does not return in that case. Programs
+// which run tests in the sandbox, like rtf itself, must call it first thing in
+// main, before parsing flags or other initialisation.
+func SandboxMain() {
+	sandboxMainCalled = true
+	if len(os.Args) > 1 && os.Args[0] == sandboxInitName {
+		os.Exit(sandboxInit())
+	}
+}
+
+// sandboxCommand changes cmd to run in new user, mount and PID namespaces,
+// and optionally a new network namespace. cmd is run by a re-executed rtf,
+// which sets up the mounts of the sandbox before it runs the original
+// command. The script runs as root within the sandbox, which is mapped to
+// the user running rtf.
+func sandboxCommand(cmd *exec.Cmd, privateNetwork bool, config RunConfig) error {
+	if !sandboxMainCalled {
+		return fmt.Errorf("the sandbox needs local.SandboxMain to be called at the start of main")
+	}
+	sc := sandboxConfig{PrivateNetwork: privateNetwork}
+	caseDir, err := filepath.Abs(config.CaseDir)
+	if err != nil {
+		return err
+	}
+	sc.ReadOnly = append(sc.ReadOnly, caseDir)
+	if config.LogDir != "" {
+		logDir, err := filepath.Abs(config.LogDir)
+		if err != nil {
+			return err
+		}
+		sc.Writable = append(sc.Writable, logDir)
+	}
+	data, err := json.Marshal(sc)
+	if err != nil {
+		return err
+	}
+
+	cmd.Args = append([]string{sandboxInitName, cmd.Path}, cmd.Args[1:]...)
+	cmd.Path = "/proc/self/exe"
+	cmd.Env = append(cmd.Env, fmt.Sprintf("%s=%s", sandboxEnv, data))
+	if cmd.SysProcAttr == nil {
+		cmd.SysProcAttr = &syscall.SysProcAttr{}
+	}
+	cmd.SysProcAttr.Cloneflags |= syscall.CLONE_NEWUSER | syscall.CLONE_NEWNS | syscall.CLONE_NEWPID
+	if privateNetwork {
+		cmd.SysProcAttr.Cloneflags |= syscall.CLONE_NEWNET
+	}
+	cmd.SysProcAttr.UidMappings = []syscall.SysProcIDMap{{ContainerID: 0, HostID: os.Getuid(), Size: 1}}
+	cmd.SysProcAttr.GidMappings = []syscall.SysProcIDMap{{ContainerID: 0, HostID: os.Getgid(), Size: 1}}
+	cmd.SysProcAttr.GidMappingsEnableSetgroups = false
+	return nil
+}
+
+// CheckSandbox returns an error describing why tests can not be run in a
+// sandbox, e.g. if unprivileged user namespaces are disabled
+func CheckSandbox(config RunConfig) error {
+	cmd := exec.Command(shExecutable, "-c", "true")
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	if err := sandboxCommand(cmd, true, config); err != nil {
+		return err
+	}
+	if err := cmd.Run(); err != nil {
+		if stderr.Len() > 0 {
+			return fmt.Errorf("%v: %s", err, bytes.TrimSpace(stderr.Bytes()))
+		}
+		return err
+	}
+	return nil
+}
+
+// sandboxInit runs in the namespaces created for a test script. It sets up
+// the sandbox, runs the script and returns its exit code. As the first
+// process in the PID namespace, all other processes in the sandbox are killed
+// when it exits.
+func sandboxInit() int {
+	var sc sandboxConfig
+	if err := json.Unmarshal([]byte(os.Getenv(sandboxEnv)), &sc); err != nil {
+		fmt.Fprintf(os.Stderr, "rtf sandbox: invalid configuration: %v\n", err)
+		return sandboxSetupFailed
+	}
+	_ = os.Unsetenv(sandboxEnv)
+
+	// The working directory has to be entered again to see the new mounts
+	cwd, err := os.Getwd()
+	if err == nil {
+		err = setupSandbox(sc)
+	}
+	if err == nil {
+		err = os.Chdir(cwd)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "rtf sandbox: %v\n", err)
+		return sandboxSetupFailed
+	}
+
+	// Signals sent to the process group also reach the script, but the
+	// default action would terminate this process and with it the sandbox.
+	sigCh := make(chan os.Signal, 1)
+	signal.Notify(sigCh, syscall.SIGINT, syscall.SIGTERM, syscall.SIGHUP, syscall.SIGQUIT)
+
+	cmd := exec.Command(os.Args[1], os.Args[2:]...)
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	if err := cmd.Run(); err != nil {
+		if ee, ok := err.(*exec.ExitError); ok {
+			if ws, ok := ee.Sys().(syscall.WaitStatus); ok && ws.Signaled() {
+				return 128 + int(ws.Signal())
+			}
+			return ee.ExitCode()
+		}
+		fmt.Fprintf(os.Stderr, "rtf sandbox: %v\n", err)
+		return sandboxSetupFailed
+	}
+	return 0
+}
+
+// setupSandbox sets up the mounts and network of the sandbox
+func setupSandbox(sc sandboxConfig) error {
+	if err := syscall.Mount("", "/", "", syscall.MS_REC|syscall.MS_PRIVATE, ""); err != nil {
+		return fmt.Errorf("failed to make mounts private: %v", err)
+	}
+
+	// Keep references to the directories, as they may be hidden by the
+	// private /tmp
+	dirs := append(append([]string{}, sc.ReadOnly...), sc.Writable...)
+	fds := make([]int, len(dirs))
+	for i, d := range dirs {
+		fd, err := syscall.Open(d, syscall.O_RDONLY|syscall.O_DIRECTORY|syscall.O_CLOEXEC, 0)
+		if err != nil {
+			return fmt.Errorf("failed to open %s: %v", d, err)
+		}
+		defer func() { _ = syscall.Close(fd) }()
+		fds[i] = fd
+	}
+
+	if err := syscall.Mount("tmpfs", "/tmp", "tmpfs", syscall.MS_NOSUID|syscall.MS_NODEV, "mode=1777"); err != nil {
+		return fmt.Errorf("failed to mount /tmp: %v", err)
+	}
+
+	// Writable directories are mounted last, so that they remain writable
+	// if they are below a read-only one
+	for i, d := range dirs {
+		if err := os.MkdirAll(d, 0755); err != nil {
+			return err
+		}
+		src := fmt.Sprintf("/proc/self/fd/%d", fds[i])
+		if err := syscall.Mount(src, d, "", syscall.MS_BIND|syscall.MS_REC, ""); err != nil {
+			return fmt.Errorf("failed to bind mount %s: %v", d, err)
+		}
+		if i >= len(sc.ReadOnly) {
+			continue
+		}
+		// The flags of the existing mount are locked in a user namespace
+		// and have to be kept when remounting
+		var st syscall.Statfs_t
+		if err := syscall.Statfs(d, &st); err != nil {
+			return err
+		}
+		flags := uintptr(syscall.MS_BIND | syscall.MS_REMOUNT | syscall.MS_RDONLY)
+		flags |= uintptr(st.Flags) & (syscall.MS_NOSUID | syscall.MS_NODEV | syscall.MS_NOEXEC | syscall.MS_NOATIME | syscall.MS_NODIRATIME)
+		if st.Flags&stRelatime != 0 {
+			flags |= syscall.MS_RELATIME
+		}
+		if err := syscall.Mount("", d, "", flags, ""); err != nil {
+			return fmt.Errorf("failed to make %s read-only: %v", d, err)
+		}
+	}
+
+	if err := syscall.Mount("proc", "/proc", "proc", syscall.MS_NOSUID|syscall.MS_NODEV|syscall.MS_NOEXEC, ""); err != nil {
+		return fmt.Errorf("failed to mount /proc: %v", err)
+	}
+
+	if sc.PrivateNetwork {
+		if err := loopbackUp(); err != nil {
+			return fmt.Errorf("failed to bring up the loopback interface: %v", err)
+		}
+	}
+	return nil
+}
+
+// stRelatime is the statfs flag for relatime mounts, see statfs(2)
+const stRelatime = 0x1000
+
+// loopbackUp brings up the loopback interface of the network namespace
+func loopbackUp() error {
+	fd, err := syscall.Socket(syscall.AF_INET, syscall.SOCK_DGRAM|syscall.SOCK_CLOEXEC, 0)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = syscall.Close(fd) }()
+
+	// struct ifreq: the interface name followed by the flags
+	var ifr [40]byte
+	copy(ifr[:syscall.IFNAMSIZ-1], "lo")
+	flags := (*uint16)(unsafe.Pointer(&ifr[syscall.IFNAMSIZ]))
+	if _, _, errno := syscall.Syscall(syscall.SYS_IOCTL, uintptr(fd), syscall.SIOCGIFFLAGS, uintptr(unsafe.Pointer(&ifr[0]))); errno != 0 {
+		return errno
+	}
+	*flags |= syscall.IFF_UP | syscall.IFF_RUNNING
+	if _, _, errno := syscall.Syscall(syscall.SYS_IOCTL, uintptr(fd), syscall.SIOCSIFFLAGS, uintptr(unsafe.Pointer(&ifr[0]))); errno != 0 {
+		return errno
+	}
+	return nil
+}
@@ -0,0 +1,24 @@
+//go:build !linux
+// +build !linux
+
+package local
+
+import (
+	"fmt"
+	"os/exec"
+)
+
+// SandboxMain does nothing as the sandbox relies on Linux namespaces
+func SandboxMain() {}
+
+// sandboxCommand always returns an error as the sandbox relies on Linux
+// namespaces
+func sandboxCommand(cmd *exec.Cmd, privateNetwork bool, config RunConfig) error {
+	return fmt.Errorf("the sandbox is only supported on Linux")
+}
+
+// CheckSandbox always returns an error as the sandbox relies on Linux
+// namespaces
+func CheckSandbox(config RunConfig) error {
+	return fmt.Errorf("the sandbox is only supported on Linux")
+}
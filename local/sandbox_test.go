@@ -0,0 +1,80 @@
+package local
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/linuxkit/rtf/logger"
+)
+
+func TestMain(m *testing.M) {
+	// The sandbox is set up by the re-executed test binary
+	SandboxMain()
+	os.Exit(m.Run())
+}
+
+func TestParseSandbox(t *testing.T) {
+	for s, exp := range map[string]int{"": sandboxDefault, "on": sandboxOn, "off": sandboxOff} {
+		got, err := parseSandbox(s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != exp {
+			t.Fatalf("Expected %q to parse as %d, got %d", s, exp, got)
+		}
+	}
+	if _, err := parseSandbox("yes"); err == nil {
+		t.Fatalf("Expected an error for an invalid SANDBOX")
+	}
+	if _, err := parseNetwork("bridge"); err == nil {
+		t.Fatalf("Expected an error for an invalid NETWORK")
+	}
+}
+
+func TestExecuteScriptSandbox(t *testing.T) {
+	dir, err := ioutil.TempDir("", "rtf")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = os.RemoveAll(dir) }()
+	caseDir := filepath.Join(dir, "cases")
+	logDir := filepath.Join(dir, "results")
+	for _, d := range []string{caseDir, logDir} {
+		if err := os.Mkdir(d, 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	config := RunConfig{
+		CaseDir: caseDir,
+		LogDir:  logDir,
+		Logger:  logger.NewLogDispatcher(map[string]logger.Logger{}),
+	}
+	if err := CheckSandbox(config); err != nil {
+		t.Skipf("sandbox not available: %v", err)
+	}
+
+	// The case directory is read-only, the result directory writable and
+	// nothing else from /tmp is visible
+	script := filepath.Join(caseDir, "test.sh")
+	content := "set -e\n" +
+		"[ \"$(id -u)\" = 0 ]\n" +
+		"! touch " + filepath.Join(caseDir, "x") + "\n" +
+		"touch " + filepath.Join(logDir, "x") + "\n" +
+		"[ ! -e " + filepath.Join(dir, "other") + " ]\n" +
+		"[ \"$(cat /proc/net/dev | grep -c :)\" = 1 ]\n"
+	if err := ioutil.WriteFile(script, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, "other"), nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	res, err := executeScript(script, caseDir, "sandbox", nil, scriptOptions{sandbox: true, privateNetwork: true}, config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.TestResult != Pass {
+		t.Fatalf("Expected sandboxed script to pass, got %s with exit code %d", TestResultNames[res.TestResult], res.ExitCode)
+	}
+}
@@ -0,0 +1,341 @@
+package local
+
+import (
+	"container/heap"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/linuxkit/rtf/logger"
+)
+
+// job is a runnable together with the jobs it has to wait for
+type job struct {
+	index      int
+	runnable   TestContainer
+	pending    int
+	dependents []*job
+	// init is the init command of the group a deinit command belongs to
+	init *job
+	// prereqs are the jobs of the tests a test depends on
+	prereqs []*job
+	started bool
+	// blockedAt is when the job first had to wait for resources held by
+	// other jobs and resourceWait how long it waited for them
+	blockedAt    time.Time
+	resourceWait time.Duration
+	results      []Result
+	err          error
+}
+
+// after makes j wait for dep to complete before it starts
+func (j *job) after(dep *job) {
+	j.pending++
+	dep.dependents = append(dep.dependents, j)
+}
+
+// skip determines if a job should not be run at all. Once a run is stopping
+// no new groups are initialised, and a group's deinit command is only run if
+// its init command was.
+func (j *job) skip(config RunConfig) bool {
+	switch groupCommandType(j.runnable) {
+	case "init":
+		return config.stopping()
+	case "deinit":
+		return j.init != nil && !j.init.started
+	}
+	return false
+}
+
+// unmetDependency returns the reason why a test job should not run because
+// one of the tests it depends on did not pass, or "" if it should run
+func (j *job) unmetDependency() string {
+	for _, p := range j.prereqs {
+		if reason := unmetDependency(p.runnable.(*Test), p.results); reason != "" {
+			return reason
+		}
+	}
+	return ""
+}
+
+// jobQueue is a priority queue of jobs which are ready to run. Jobs are run
+// in the order they were gathered in, so that a single worker runs them in
+// exactly the same order as a sequential run would.
+type jobQueue []*job
+
+func (q jobQueue) Len() int            { return len(q) }
+func (q jobQueue) Less(i, j int) bool  { return q[i].index < q[j].index }
+func (q jobQueue) Swap(i, j int)       { q[i], q[j] = q[j], q[i] }
+func (q *jobQueue) Push(x interface{}) { *q = append(*q, x.(*job)) }
+func (q *jobQueue) Pop() interface{} {
+	old := *q
+	n := len(old)
+	j := old[n-1]
+	*q = old[:n-1]
+	return j
+}
+
+// resourceLocks tracks the resources held by the tests which are running, so
+// that tests which need the same resource, or an EXCLUSIVE test and any other
+// test, never run at the same time
+type resourceLocks struct {
+	held      map[string]bool
+	tests     int
+	exclusive bool
+	// waitingExclusive is set while an EXCLUSIVE test waits for the running
+	// tests to finish, so that it is not starved by tests starting after it
+	waitingExclusive bool
+}
+
+func newResourceLocks() *resourceLocks {
+	return &resourceLocks{held: map[string]bool{}}
+}
+
+// acquire takes the resources needed by a job and returns false if they are
+// not available
+func (l *resourceLocks) acquire(j *job) bool {
+	t, ok := j.runnable.(*Test)
+	if !ok {
+		return true
+	}
+	if l.exclusive || l.waitingExclusive && !t.Tags.Exclusive {
+		return false
+	}
+	if t.Tags.Exclusive {
+		if l.tests > 0 {
+			l.waitingExclusive = true
+			return false
+		}
+		l.waitingExclusive = false
+		l.exclusive = true
+	}
+	for _, r := range t.Resources {
+		if l.held[r] {
+			return false
+		}
+	}
+	for _, r := range t.Resources {
+		l.held[r] = true
+	}
+	l.tests++
+	return true
+}
+
+// release gives up the resources held by a job
+func (l *resourceLocks) release(j *job) {
+	t, ok := j.runnable.(*Test)
+	if !ok || !j.started {
+		return
+	}
+	for _, r := range t.Resources {
+		delete(l.held, r)
+	}
+	l.tests--
+	if t.Tags.Exclusive {
+		l.exclusive = false
+	}
+}
+
+// groupFrame tracks an open group while building the jobs
+type groupFrame struct {
+	init    *job
+	members []*job
+}
+
+// buildJobs turns the flat list of runnables returned by Gather into jobs.
+// Gather brackets the runnables of each group with the group's init and deinit
+// commands, so the group hierarchy can be recovered from the list. Each group
+// acts as a barrier: its init has to complete before any of its children
+// start and its deinit only starts once all children have completed. In
+// addition, tests wait for the tests listed in their DEPENDS tag.
+func buildJobs(runnables []TestContainer) []*job {
+	jobs := make([]*job, len(runnables))
+	var stack []*groupFrame
+	for i, r := range runnables {
+		j := &job{index: i, runnable: r}
+		jobs[i] = j
+
+		var parent *groupFrame
+		if len(stack) > 0 {
+			parent = stack[len(stack)-1]
+		}
+
+		switch groupCommandType(r) {
+		case "init":
+			if parent != nil && parent.init != nil {
+				j.after(parent.init)
+			}
+			stack = append(stack, &groupFrame{init: j})
+			continue
+		case "deinit":
+			if parent == nil {
+				break
+			}
+			j.init = parent.init
+			j.after(parent.init)
+			for _, m := range parent.members {
+				j.after(m)
+			}
+			stack = stack[:len(stack)-1]
+			if len(stack) == 0 {
+				continue
+			}
+			parent = stack[len(stack)-1]
+		default:
+			if parent != nil {
+				j.after(parent.init)
+			}
+		}
+		if parent != nil {
+			parent.members = append(parent.members, j)
+		}
+	}
+
+	// Tests also wait for the tests they depend on, if those are run
+	byTest := map[*Test]*job{}
+	for _, j := range jobs {
+		if t, ok := j.runnable.(*Test); ok {
+			byTest[t] = j
+		}
+	}
+	for _, j := range jobs {
+		t, ok := j.runnable.(*Test)
+		if !ok {
+			continue
+		}
+		for _, dep := range t.Depends {
+			if d, ok := byTest[dep]; ok {
+				j.after(d)
+				j.prereqs = append(j.prereqs, d)
+			}
+		}
+	}
+	return jobs
+}
+
+// groupCommandType returns the type of a group command or "" if the runnable
+// is not a group command
+func groupCommandType(r TestContainer) string {
+	switch g := r.(type) {
+	case GroupCommand:
+		return g.Type
+	case *GroupCommand:
+		return g.Type
+	}
+	return ""
+}
+
+// runJobs runs the runnables on a pool of config.Jobs workers, honouring the
+// ordering constraints between group init/deinit commands and tests, and the
+// dependencies between tests. Tests whose dependencies did not pass are
+// skipped, or cancelled once the run is stopping, and tests which need a
+// resource held by a running test wait for it to finish. Results are returned
+// in the same order as the runnables, regardless of the order in which they
+// completed. Once a runnable returns an error no further runnables are started
+// and the first error is returned.
+func runJobs(runnables []TestContainer, config RunConfig) ([]Result, error) {
+	jobs := buildJobs(runnables)
+
+	workers := config.Jobs
+	if workers < 1 {
+		workers = 1
+	}
+	if workers > len(jobs) {
+		workers = len(jobs)
+	}
+
+	work := make(chan *job)
+	done := make(chan *job)
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := range work {
+				j.results, j.err = j.runnable.Run(config)
+				done <- j
+			}
+		}()
+	}
+
+	ready := &jobQueue{}
+	for _, j := range jobs {
+		if t, ok := j.runnable.(*Test); ok && workers > 1 {
+			config.Logger.Log(logger.LevelInfo, fmt.Sprintf("Pending test %s", t.Name()))
+		}
+		if j.pending == 0 {
+			heap.Push(ready, j)
+		}
+	}
+	release := func(j *job) {
+		for _, d := range j.dependents {
+			d.pending--
+			if d.pending == 0 {
+				heap.Push(ready, d)
+			}
+		}
+	}
+
+	var firstErr error
+	locks := newResourceLocks()
+	running, idle := 0, workers
+	for {
+		var blocked []*job
+		for firstErr == nil && idle > 0 && ready.Len() > 0 {
+			j := heap.Pop(ready).(*job)
+			if j.skip(config) {
+				release(j)
+				continue
+			}
+			// Once the run is stopping, a test is cancelled by its Run even
+			// if a test it depends on did not pass
+			if !config.stopping() {
+				if reason := j.unmetDependency(); reason != "" {
+					j.results = j.runnable.(*Test).skip(reason, config)
+					release(j)
+					continue
+				}
+			}
+			if !locks.acquire(j) {
+				if j.blockedAt.IsZero() {
+					j.blockedAt = time.Now()
+				}
+				blocked = append(blocked, j)
+				continue
+			}
+			if !j.blockedAt.IsZero() {
+				j.resourceWait = time.Since(j.blockedAt)
+				config.Logger.Log(logger.LevelInfo, fmt.Sprintf("Test %s waited %.2fs for its resources", j.runnable.(*Test).Name(), j.resourceWait.Seconds()))
+			}
+			j.started = true
+			work <- j
+			running++
+			idle--
+		}
+		for _, j := range blocked {
+			heap.Push(ready, j)
+		}
+		if running == 0 {
+			break
+		}
+		j := <-done
+		running--
+		idle++
+		locks.release(j)
+		for i := range j.results {
+			j.results[i].ResourceWait = j.resourceWait
+		}
+		if j.err != nil && firstErr == nil {
+			firstErr = j.err
+		}
+		release(j)
+	}
+	close(work)
+	wg.Wait()
+
+	var all []Result
+	for _, j := range jobs {
+		all = append(all, j.results...)
+	}
+	return all, firstErr
+}
@@ -0,0 +1,177 @@
+package local
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/linuxkit/rtf/logger"
+)
+
+// fakeRunnable is a TestContainer which records how many runnables are
+// running concurrently
+type fakeRunnable struct {
+	name    string
+	mu      *sync.Mutex
+	running *int
+	maxSeen *int
+}
+
+func (f fakeRunnable) Order() int                   { return 0 }
+func (f fakeRunnable) List(config RunConfig) []Info { return nil }
+func (f fakeRunnable) Gather(config RunConfig) ([]TestContainer, int) {
+	return []TestContainer{f}, 1
+}
+
+func (f fakeRunnable) Run(config RunConfig) ([]Result, error) {
+	f.mu.Lock()
+	*f.running++
+	if *f.running > *f.maxSeen {
+		*f.maxSeen = *f.running
+	}
+	f.mu.Unlock()
+
+	time.Sleep(10 * time.Millisecond)
+
+	f.mu.Lock()
+	*f.running--
+	f.mu.Unlock()
+	return []Result{{Name: f.name}}, nil
+}
+
+func TestRunJobs(t *testing.T) {
+	var (
+		mu               sync.Mutex
+		running, maxSeen int
+	)
+	var runnables []TestContainer
+	for i := 0; i < 20; i++ {
+		runnables = append(runnables, fakeRunnable{fmt.Sprintf("test%d", i), &mu, &running, &maxSeen})
+	}
+	config := RunConfig{
+		Jobs:   3,
+		Logger: logger.NewLogDispatcher(map[string]logger.Logger{}),
+	}
+
+	results, err := runJobs(runnables, config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if maxSeen > config.Jobs {
+		t.Fatalf("Expected at most %d concurrent runnables, got %d", config.Jobs, maxSeen)
+	}
+	if len(results) != len(runnables) {
+		t.Fatalf("Expected %d results, got %d", len(runnables), len(results))
+	}
+	for i, r := range results {
+		if exp := fmt.Sprintf("test%d", i); r.Name != exp {
+			t.Fatalf("Results out of order: expected %s, got %s", exp, r.Name)
+		}
+	}
+}
+
+func TestBuildJobs(t *testing.T) {
+	test := func(name string) TestContainer {
+		return fakeRunnable{name: name}
+	}
+	runnables := []TestContainer{
+		GroupCommand{Name: "a", Type: "init"},
+		test("a.1"),
+		GroupCommand{Name: "a.b", Type: "init"},
+		test("a.b.1"),
+		test("a.b.2"),
+		GroupCommand{Name: "a.b", Type: "deinit"},
+		test("a.2"),
+		GroupCommand{Name: "a", Type: "deinit"},
+	}
+	jobs := buildJobs(runnables)
+
+	deps := map[int][]int{}
+	for _, j := range jobs {
+		for _, d := range j.dependents {
+			deps[d.index] = append(deps[d.index], j.index)
+		}
+	}
+	expected := map[int][]int{
+		1: {0},
+		2: {0},
+		3: {2},
+		4: {2},
+		5: {2, 3, 4},
+		6: {0},
+		7: {0, 1, 5, 6},
+	}
+	for i, j := range jobs {
+		if j.pending != len(expected[i]) {
+			t.Fatalf("Expected %d dependencies for %d, got %d", len(expected[i]), i, j.pending)
+		}
+		got := map[int]bool{}
+		for _, d := range deps[i] {
+			got[d] = true
+		}
+		for _, d := range expected[i] {
+			if !got[d] {
+				t.Fatalf("Expected %d to depend on %d, got %v", i, d, deps[i])
+			}
+		}
+	}
+}
+
+func TestResourceLocks(t *testing.T) {
+	newJob := func(exclusive bool, resources ...string) *job {
+		return &job{runnable: &Test{Resources: resources, Tags: &Tags{Exclusive: exclusive}}}
+	}
+	docker := newJob(false, "docker", "port:8080")
+	port := newJob(false, "port:8080")
+	kvm := newJob(false, "/dev/kvm")
+	exclusive := newJob(true)
+	other := newJob(false)
+
+	l := newResourceLocks()
+	acquire := func(j *job, expected bool) {
+		if got := l.acquire(j); got != expected {
+			t.Fatalf("Expected acquire to return %v, got %v", expected, got)
+		}
+		j.started = expected
+	}
+	acquire(docker, true)
+	acquire(port, false)
+	acquire(kvm, true)
+	acquire(exclusive, false)
+	// Tests queued after a waiting EXCLUSIVE test do not start
+	acquire(other, false)
+
+	l.release(docker)
+	acquire(port, false)
+	l.release(kvm)
+	acquire(exclusive, true)
+	acquire(other, false)
+	l.release(exclusive)
+	acquire(port, true)
+	acquire(other, true)
+}
+
+func TestRunJobsCancelsDependents(t *testing.T) {
+	install := &Test{Tags: &Tags{Name: "p.install"}}
+	upgrade := &Test{Tags: &Tags{Name: "p.upgrade"}, Depends: []*Test{install}}
+	config := RunConfig{
+		Jobs:         1,
+		Logger:       logger.NewLogDispatcher(map[string]logger.Logger{}),
+		FailureLimit: NewFailureLimit(1),
+	}
+	config.FailureLimit.add(Fail)
+
+	results, err := runJobs([]TestContainer{install, upgrade}, config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 2 {
+		t.Fatalf("Expected 2 results, got %d", len(results))
+	}
+	for _, r := range results {
+		if r.TestResult != Cancel {
+			t.Fatalf("Expected %s to be cancelled once the failure limit is reached, got %s", r.Name, TestResultNames[r.TestResult])
+		}
+	}
+}
@@ -2,31 +2,43 @@ package local
 
 import (
 	"bufio"
+	"errors"
 	"fmt"
+	"io"
+	"io/ioutil"
 	"os"
 	"os/exec"
 	"path/filepath"
 	"runtime"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"syscall"
 	"time"
 
 	"github.com/linuxkit/rtf/logger"
 )
 
-var (
-	shExecutable = "/bin/sh"
-	psExecutable = "powershell.exe"
+var shExecutable = "/bin/sh"
+
+const (
+	// cancelExitCode is the exit code of a cancelled test (RT_TEST_CANCEL)
+	cancelExitCode = 253
+	// skipExitCode is the exit code of a test which found at runtime that
+	// it can not run, e.g. because a precondition is not met (RT_TEST_SKIP)
+	skipExitCode = 254
+	// skipReasonMarker starts a line on stdout giving the reason for skipping
+	skipReasonMarker = "RT_SKIP_REASON:"
+	// metricMarker starts a line on stdout reporting a metric
+	metricMarker = "RT_METRIC:"
 )
 
+// outputWaitDelay is how long to wait for the output of a script after it
+// exited, e.g. if it left processes behind which still hold on to its stdout
+const outputWaitDelay = time.Second
+
 func init() {
 	if runtime.GOOS != "windows" {
-		t, err := exec.LookPath("pwsh")
-		if err != nil {
-			psExecutable = ""
-		}
-		psExecutable = t
 		return
 	}
 
@@ -45,47 +57,74 @@ func init() {
 	}
 }
 
-func executeScript(script, cwd, name string, args []string, config RunConfig) (Result, error) {
+// scriptOptions are the settings for running a single script
+type scriptOptions struct {
+	// timeout after which the script and any processes it started are killed
+	timeout time.Duration
+	// env are additional KEY=VALUE environment variables from ENV tags
+	env []string
+	// scratch creates a fresh scratch directory for the script, exposed
+	// as RT_TMPDIR and cleaned up according to config.KeepTmp
+	scratch bool
+	// tmpCwd runs the script in its scratch directory instead of cwd
+	tmpCwd bool
+	// artifacts creates an artifacts directory for the script, exposed as
+	// RT_ARTIFACTS, and records the files stored in it in the Result
+	artifacts bool
+	// cgroup runs the script in its own cgroup, if config.Cgroups is set
+	cgroup bool
+	// limits are applied to the cgroup of the script
+	limits resourceLimits
+	// sandbox runs the script in new namespaces with a private /tmp and
+	// a read-only view of the case directory
+	sandbox bool
+	// privateNetwork only gives a sandboxed script a loopback interface
+	privateNetwork bool
+	// resultFile passes the script a file, as RT_RESULT_FILE, to report
+	// metrics, notes, warnings, links and sub-results in
+	resultFile bool
+	// outputFormat is the format of stdout to parse sub-results from
+	outputFormat string
+}
+
+// executeScript runs script in cwd
+func executeScript(script, cwd, name string, args []string, opts scriptOptions, config RunConfig) (Result, error) {
 	if name == "" {
 		name = "UNKNOWN"
 	}
 	startTime := time.Now()
-	var cmdArgs []string
-	executable := shExecutable
-	if filepath.Ext(script) == ".ps1" {
-		executable = psExecutable
-		cmdArgs = append(cmdArgs, []string{"-NoProfile", "-NonInteractive"}...)
-	} else {
-		if config.Extra {
-			cmdArgs = append(cmdArgs, "-x")
-		}
-	}
-	if executable == "" {
-		return Result{}, fmt.Errorf("can't find a suitable shell to execute %s", script)
-	}
-	cmdArgs = append(cmdArgs, script)
-	cmdArgs = append(cmdArgs, args...)
-	cmd := exec.Command(executable, cmdArgs...)
-
-	stdout, err := cmd.StdoutPipe()
+	executor, err := executorFor(script)
 	if err != nil {
 		return Result{}, err
 	}
-	stderr, err := cmd.StderrPipe()
+	cmd, err := executor.Command(script, args, config)
 	if err != nil {
 		return Result{}, err
 	}
 
+	// Output is copied into our own pipes, so that cmd.Wait() returns only
+	// once all output has been read, unless processes left behind by the
+	// script keep it open for longer than outputWaitDelay.
+	stdout, stdoutW := io.Pipe()
+	stderr, stderrW := io.Pipe()
+	cmd.Stdout = stdoutW
+	cmd.Stderr = stderrW
+	cmd.WaitDelay = outputWaitDelay
+
 	rootDir := os.Getenv("RT_ROOT")
 	if rootDir == "" {
 		// Assume the source is in the GOPATH
 		goPath := os.Getenv("GOPATH")
 		rootDir = filepath.Join(goPath, "src", "github.com", "linuxkit", "rtf")
 	}
-	libDir := filepath.Join(rootDir, "lib", "lib.sh")
-	if executable == psExecutable {
-		libDir = filepath.Join(rootDir, "lib", "lib.ps1")
-	}
+	var (
+		res      TestResult
+		exitCode int
+		signal   string
+		usage    *Usage
+		cgUsage  *CgroupUsage
+	)
+	libDir := executor.Lib(rootDir)
 	utilsDir := filepath.Join(rootDir, "bin")
 
 	projectDir, err := filepath.Abs(config.CaseDir)
@@ -95,7 +134,20 @@ func executeScript(script, cwd, name string, args []string, config RunConfig) (R
 
 	labels := makeLabelString(config.Labels, config.NotLabels, ":")
 
+	// Environment variables from the ENV tags override the inherited
+	// environment and are in turn overridden by the ones from the command
+	// line. The RT_* variables always take precedence.
 	env := os.Environ()
+	// Only the variables set by rtf are logged, as the inherited ones may
+	// contain secrets
+	logged := map[string]bool{}
+	for _, vars := range [][]string{opts.env, config.Env} {
+		for _, v := range vars {
+			parts := strings.SplitN(v, "=", 2)
+			setEnv(&env, parts[0], parts[1])
+			logged[parts[0]] = true
+		}
+	}
 	setEnv(&env, "RT_ROOT", rootDir)
 	setEnv(&env, "RT_UTILS", utilsDir)
 	setEnv(&env, "RT_PROJECT_ROOT", projectDir)
@@ -103,27 +155,78 @@ func executeScript(script, cwd, name string, args []string, config RunConfig) (R
 	setEnv(&env, "RT_OS_VER", config.SystemInfo.Version)
 	setEnv(&env, "RT_LABELS", labels)
 	setEnv(&env, "RT_TEST_NAME", name)
-	setEnv(&env, "RT_LIB", libDir)
+	if libDir != "" {
+		setEnv(&env, "RT_LIB", libDir)
+	}
 	setEnv(&env, "RT_RESULTS", config.LogDir)
-	if executable == shExecutable {
-		envPath := os.Getenv("PATH")
-		setEnv(&env, "PATH", fmt.Sprintf("%s:%s", utilsDir, envPath))
-		if runtime.GOOS == "windows" {
-			setEnv(&env, "MSYS_NO_PATHCONV", "1")
+	if opts.scratch {
+		tmpDir, err := newScratchDir(name, config)
+		if err != nil {
+			return Result{}, err
+		}
+		setEnv(&env, "RT_TMPDIR", tmpDir)
+		if opts.tmpCwd {
+			cwd = tmpDir
+		}
+		defer func() { cleanupScratchDir(tmpDir, name, res, config) }()
+	}
+	var artifactDir string
+	if opts.artifacts {
+		artifactDir = artifactsDir(name, config)
+		if err := os.MkdirAll(artifactDir, 0755); err != nil {
+			return Result{}, err
+		}
+		setEnv(&env, "RT_ARTIFACTS", artifactDir)
+	}
+	var resultFilePath string
+	if opts.resultFile {
+		resultFilePath = filepath.Join(config.LogDir, name+".result.jsonl")
+		// Remove the file of a previous attempt
+		if err := os.Remove(resultFilePath); err != nil && !os.IsNotExist(err) {
+			return Result{}, err
+		}
+		setEnv(&env, "RT_RESULT_FILE", resultFilePath)
+	}
+	executor.SetupEnv(&env, utilsDir)
+	for _, e := range env {
+		key := strings.SplitN(e, "=", 2)[0]
+		if logged[key] || strings.HasPrefix(key, "RT_") {
+			config.Logger.Log(logger.LevelDebug, fmt.Sprintf("Environment: %s", redactEnv(e)))
 		}
-	} else {
-		envPath := os.Getenv("Path")
-		setEnv(&env, "Path", fmt.Sprintf("%s;%s", utilsDir, envPath))
 	}
 
 	cmd.Env = env
 	cmd.Dir = cwd
+	setProcessGroup(cmd)
+
+	var cg *cgroup
+	if opts.cgroup {
+		if opts.limits.set() && config.Cgroups == nil {
+			config.Logger.Log(logger.LevelWarning, fmt.Sprintf("MEMORY_LIMIT and CPU_LIMIT of %s are ignored without --cgroups", name))
+		}
+		cg, err = config.Cgroups.create(name, opts.limits, config)
+		if err != nil {
+			config.Logger.Log(logger.LevelError, fmt.Sprintf("Failed to create cgroup for %s, running it without: %v", name, err))
+		}
+		if cg != nil {
+			cg.attach(cmd)
+		}
+	}
+	if opts.sandbox {
+		if err := sandboxCommand(cmd, opts.privateNetwork, config); err != nil {
+			return Result{}, err
+		}
+	}
 
 	var wg sync.WaitGroup
 
 	wg.Add(2)
 
-	var bmResult string
+	var bmResult, skipReason string
+	var metrics map[string]Metric
+	var metricErrors []string
+	parser := newOutputParser(opts.outputFormat)
+	var steps stepTracker
 	go func() {
 		scanner := bufio.NewScanner(stdout)
 		for scanner.Scan() {
@@ -135,8 +238,27 @@ func executeScript(script, cwd, name string, args []string, config RunConfig) (R
 					bmResult = strings.TrimSpace(tmp[1])
 				}
 			}
+			if strings.HasPrefix(line, skipReasonMarker) {
+				skipReason = strings.TrimSpace(strings.TrimPrefix(line, skipReasonMarker))
+			}
+			if strings.HasPrefix(line, metricMarker) {
+				n, m, err := parseMetricLine(strings.TrimPrefix(line, metricMarker))
+				if err != nil {
+					metricErrors = append(metricErrors, fmt.Sprintf("%s %v", metricMarker, err))
+				} else {
+					if metrics == nil {
+						metrics = map[string]Metric{}
+					}
+					metrics[n] = m
+				}
+			}
+			if parser != nil {
+				parser.parseLine(line)
+			}
+			steps.parseLine(line, time.Now())
 			config.Logger.Log(logger.LevelStdout, line)
 		}
+		_, _ = io.Copy(ioutil.Discard, stdout)
 		wg.Done()
 	}()
 
@@ -145,18 +267,40 @@ func executeScript(script, cwd, name string, args []string, config RunConfig) (R
 		for scanner.Scan() {
 			config.Logger.Log(logger.LevelStderr, scanner.Text())
 		}
+		_, _ = io.Copy(ioutil.Discard, stderr)
 		wg.Done()
 	}()
 
 	config.Logger.Log(logger.LevelInfo, fmt.Sprintf("Running command: %+v", cmd.Args))
-	var res TestResult
 	if err := cmd.Start(); err != nil {
 		config.Logger.Log(logger.LevelCritical, err.Error())
 		res = Fail
 	}
 
 	if res != Fail {
-		if err := cmd.Wait(); err != nil {
+		config.Interrupt.register(cmd)
+		var timedOut int32
+		if opts.timeout > 0 {
+			timer := time.AfterFunc(opts.timeout, func() {
+				atomic.StoreInt32(&timedOut, 1)
+				config.Logger.Log(logger.LevelError, fmt.Sprintf("%s timed out after %s", name, opts.timeout))
+				if err := killProcessGroup(cmd); err != nil {
+					config.Logger.Log(logger.LevelCritical, err.Error())
+				}
+			})
+			defer timer.Stop()
+		}
+		err := cmd.Wait()
+		if errors.Is(err, exec.ErrWaitDelay) {
+			// The script exited successfully but left processes behind
+			// which still hold on to its output
+			config.Logger.Log(logger.LevelWarning, fmt.Sprintf("%s left processes behind which keep its output open", name))
+			err = nil
+		}
+		signalled := config.Interrupt.unregister(cmd)
+		if atomic.LoadInt32(&timedOut) == 1 {
+			res = Timeout
+		} else if err != nil {
 			v, ok := err.(*exec.ExitError)
 			if !ok {
 				config.Logger.Log(logger.LevelCritical, err.Error())
@@ -165,26 +309,114 @@ func executeScript(script, cwd, name string, args []string, config RunConfig) (R
 				// FIXME: UNIX ONLY
 				rc := v.Sys().(syscall.WaitStatus).ExitStatus()
 				switch rc {
-				case 253:
+				case cancelExitCode:
 					res = Cancel
+				case skipExitCode:
+					res = Skip
 				default:
 					res = Fail
 				}
 			}
 		}
+		if signalled && res != Pass {
+			res = Cancel
+		}
+		if ps := cmd.ProcessState; ps != nil {
+			exitCode = ps.ExitCode()
+			signal = exitSignal(ps)
+			usage = newUsage(ps)
+			msg := fmt.Sprintf("%s exited with code %d", name, exitCode)
+			if signal != "" {
+				msg = fmt.Sprintf("%s terminated by signal %s", name, signal)
+			}
+			config.Logger.Log(logger.LevelInfo, fmt.Sprintf("%s, %s", msg, usage))
+		}
+	}
+	if cg != nil {
+		cgUsage = cg.destroy(config)
+		if cgUsage.Killed > 0 {
+			config.Logger.Log(logger.LevelWarning, fmt.Sprintf("Killed %d processes left behind by %s", cgUsage.Killed, name))
+		}
+		config.Logger.Log(logger.LevelInfo, fmt.Sprintf("%s cgroup usage: %s", name, cgUsage))
 	}
 
+	_ = stdoutW.Close()
+	_ = stderrW.Close()
 	wg.Wait()
 
 	endTime := time.Now()
 	duration := endTime.Sub(startTime)
+	stepList := steps.finish(endTime)
+
+	// The reason is only used if the script was skipped
+	if res != Skip {
+		skipReason = ""
+	}
+
+	var artifacts []Artifact
+	if artifactDir != "" {
+		artifacts, err = collectArtifacts(artifactDir, config.LogDir)
+		if err != nil {
+			config.Logger.Log(logger.LevelError, fmt.Sprintf("Failed to collect artifacts of %s: %v", name, err))
+		}
+		for _, a := range artifacts {
+			config.Logger.Log(logger.LevelInfo, fmt.Sprintf("Artifact %s (%d bytes, sha256:%s)", a.Path, a.Size, a.SHA256))
+		}
+	}
+	rf := &resultFile{}
+	if resultFilePath != "" {
+		rf, err = parseResultFile(resultFilePath)
+		if err != nil {
+			config.Logger.Log(logger.LevelError, fmt.Sprintf("Failed to read result file of %s: %v", name, err))
+			rf = &resultFile{}
+		}
+	}
+	// Metrics in the result file take precedence over those on stdout
+	for n, m := range metrics {
+		if _, ok := rf.metrics[n]; ok {
+			continue
+		}
+		if rf.metrics == nil {
+			rf.metrics = map[string]Metric{}
+		}
+		rf.metrics[n] = m
+	}
+	rf.warnings = append(append(metricErrors, steps.warnings...), rf.warnings...)
+	if parser != nil {
+		rf.subResults = append(rf.subResults, parser.subResults()...)
+	}
+	for _, n := range rf.notes {
+		config.Logger.Log(logger.LevelInfo, fmt.Sprintf("Note: %s", n))
+	}
+	for _, w := range rf.warnings {
+		config.Logger.Log(logger.LevelWarning, w)
+	}
+	for _, sr := range rf.subResults {
+		config.Logger.Log(logger.LevelInfo, fmt.Sprintf("Sub-result %s: %s", sr.Name, TestResultNames[sr.TestResult]))
+	}
+	for _, st := range stepList {
+		config.Logger.Log(logger.LevelInfo, fmt.Sprintf("Step %s: %.2fs", st.Name, st.Duration.Seconds()))
+	}
+
 	return Result{
 		Name:            name,
 		TestResult:      res,
+		Reason:          skipReason,
 		BenchmarkResult: bmResult,
 		StartTime:       startTime,
 		Duration:        duration,
 		EndTime:         endTime,
+		Artifacts:       artifacts,
+		ExitCode:        exitCode,
+		Signal:          signal,
+		Usage:           usage,
+		Cgroup:          cgUsage,
+		Metrics:         rf.metrics,
+		Notes:           rf.notes,
+		Warnings:        rf.warnings,
+		Links:           rf.links,
+		SubResults:      rf.subResults,
+		Steps:           stepList,
 	}, nil
 }
 
@@ -204,3 +436,14 @@ func setEnv(env *[]string, key, value string) {
 
 	*env = append(*env, fmt.Sprintf("%s=%s", key, value))
 }
+
+// getEnv returns the value of key in the environment variables passed in
+func getEnv(env []string, key string) string {
+	for _, e := range env {
+		parts := strings.SplitN(e, "=", 2)
+		if len(parts) == 2 && parts[0] == key {
+			return parts[1]
+		}
+	}
+	return ""
+}
@@ -1,8 +1,17 @@
 package local
 
 import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
 	"reflect"
+	"runtime"
+	"strings"
 	"testing"
+	"time"
+
+	"github.com/linuxkit/rtf/logger"
 )
 
 func TestSetEnv(t *testing.T) {
@@ -34,3 +43,219 @@ func TestSetEnv(t *testing.T) {
 		t.Fatalf("Adding a variable to a malformed environment failed: %v != %v", env, exp)
 	}
 }
+
+func TestExecuteScriptTimeout(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("process groups are not supported on Windows")
+	}
+	dir, err := ioutil.TempDir("", "rtf")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = os.RemoveAll(dir) }()
+
+	// The background sleep keeps stdout open, so the test only returns if the
+	// whole process group is killed.
+	script := filepath.Join(dir, "test.sh")
+	if err := ioutil.WriteFile(script, []byte("sleep 30 &\nsleep 30\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	config := RunConfig{
+		CaseDir: dir,
+		LogDir:  dir,
+		Logger:  logger.NewLogDispatcher(map[string]logger.Logger{}),
+	}
+
+	start := time.Now()
+	res, err := executeScript(script, dir, "timeout", nil, scriptOptions{timeout: 100 * time.Millisecond}, config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.TestResult != Timeout {
+		t.Fatalf("Expected result %s, got %s", TestResultNames[Timeout], TestResultNames[res.TestResult])
+	}
+	if res.ExitCode != -1 || res.Signal != "killed" {
+		t.Fatalf("Expected script to be killed, got exit code %d and signal %q", res.ExitCode, res.Signal)
+	}
+	if res.Usage == nil || res.Usage.MaxRSS == 0 {
+		t.Fatalf("Expected resource usage to be recorded, got %+v", res.Usage)
+	}
+	if elapsed := time.Since(start); elapsed > 10*time.Second {
+		t.Fatalf("Script was not killed in time, took %s", elapsed)
+	}
+}
+
+func TestExecuteScriptInterrupted(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("process groups are not supported on Windows")
+	}
+	dir, err := ioutil.TempDir("", "rtf")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = os.RemoveAll(dir) }()
+
+	// The script ignores SIGINT so it has to be killed after the grace period
+	script := filepath.Join(dir, "test.sh")
+	if err := ioutil.WriteFile(script, []byte("trap '' INT\nsleep 30 &\nwait\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	config := RunConfig{
+		CaseDir:   dir,
+		LogDir:    dir,
+		Logger:    logger.NewLogDispatcher(map[string]logger.Logger{}),
+		Interrupt: NewInterrupt(100 * time.Millisecond),
+	}
+
+	go func() {
+		time.Sleep(200 * time.Millisecond)
+		config.Interrupt.Signal(os.Interrupt)
+	}()
+	start := time.Now()
+	res, err := executeScript(script, dir, "interrupted", nil, scriptOptions{}, config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.TestResult != Cancel {
+		t.Fatalf("Expected result %s, got %s", TestResultNames[Cancel], TestResultNames[res.TestResult])
+	}
+	if elapsed := time.Since(start); elapsed > 10*time.Second {
+		t.Fatalf("Script was not killed in time, took %s", elapsed)
+	}
+}
+
+func TestExecuteScriptScratchDir(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("scripts are run with bash on Windows")
+	}
+	dir, err := ioutil.TempDir("", "rtf")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = os.RemoveAll(dir) }()
+
+	// The script leaves a file in its working directory and passes or fails
+	// depending on its argument
+	script := filepath.Join(dir, "test.sh")
+	if err := ioutil.WriteFile(script, []byte("[ \"$PWD\" = \"$RT_TMPDIR\" ] || exit 2\ntouch file\nexit $1\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tc := range []struct {
+		keepTmp  KeepTmp
+		exitCode string
+		kept     bool
+	}{
+		{KeepTmpOnFailure, "0", false},
+		{KeepTmpOnFailure, "1", true},
+		{KeepTmpAlways, "0", true},
+		{KeepTmpNever, "1", false},
+	} {
+		name := fmt.Sprintf("%s-%s", KeepTmpNames[tc.keepTmp], tc.exitCode)
+		config := RunConfig{
+			CaseDir: dir,
+			LogDir:  dir,
+			Logger:  logger.NewLogDispatcher(map[string]logger.Logger{}),
+			KeepTmp: tc.keepTmp,
+		}
+		res, err := executeScript(script, dir, name, []string{tc.exitCode}, scriptOptions{scratch: true, tmpCwd: true}, config)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if exp := tc.exitCode == "0"; (res.TestResult == Pass) != exp {
+			t.Fatalf("%s: unexpected result %s", name, TestResultNames[res.TestResult])
+		}
+		if exp := tc.exitCode; fmt.Sprint(res.ExitCode) != exp {
+			t.Fatalf("%s: expected exit code %s, got %d", name, exp, res.ExitCode)
+		}
+		_, err = os.Stat(filepath.Join(dir, name+".tmp", "file"))
+		if kept := err == nil; kept != tc.kept {
+			t.Fatalf("%s: expected scratch directory kept to be %v, got %v", name, tc.kept, kept)
+		}
+		if _, err := os.Stat(filepath.Join(dir, "file")); err == nil {
+			t.Fatalf("%s: script did not run in its scratch directory", name)
+		}
+	}
+}
+
+func TestExecuteScriptSkip(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("scripts are run with bash on Windows")
+	}
+	dir, err := ioutil.TempDir("", "rtf")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = os.RemoveAll(dir) }()
+
+	script := filepath.Join(dir, "test.sh")
+	if err := ioutil.WriteFile(script, []byte("echo 'RT_SKIP_REASON: no /dev/kvm'\nexit $1\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	config := RunConfig{
+		CaseDir: dir,
+		LogDir:  dir,
+		Logger:  logger.NewLogDispatcher(map[string]logger.Logger{}),
+	}
+
+	res, err := executeScript(script, dir, "skip", []string{"254"}, scriptOptions{}, config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.TestResult != Skip || res.Reason != "no /dev/kvm" {
+		t.Fatalf("Expected skip with reason, got %s with reason %q", TestResultNames[res.TestResult], res.Reason)
+	}
+
+	// The reason is ignored unless the script exits with the skip exit code
+	res, err = executeScript(script, dir, "fail", []string{"1"}, scriptOptions{}, config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.TestResult != Fail || res.Reason != "" {
+		t.Fatalf("Expected failure without reason, got %s with reason %q", TestResultNames[res.TestResult], res.Reason)
+	}
+}
+
+func TestExecuteScriptEnvLog(t *testing.T) {
+	dir, err := ioutil.TempDir("", "rtf")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = os.RemoveAll(dir) }()
+
+	t.Setenv("DATABASE_URL", "postgres://user:secret@db")
+	script := filepath.Join(dir, "test.sh")
+	if err := ioutil.WriteFile(script, []byte("exit 0\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	logFile := filepath.Join(dir, "test.log")
+	f, err := os.Create(logFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = f.Close() }()
+	fileLogger := logger.NewFileLogger(f)
+	fileLogger.SetLevel(logger.LevelDebug)
+	config := RunConfig{
+		CaseDir: dir,
+		LogDir:  dir,
+		Env:     []string{"FOO=bar"},
+		Logger:  logger.NewLogDispatcher(map[string]logger.Logger{logFile: fileLogger}),
+	}
+
+	if _, err := executeScript(script, dir, "env", nil, scriptOptions{env: []string{"BAZ=qux"}}, config); err != nil {
+		t.Fatal(err)
+	}
+	log, err := ioutil.ReadFile(logFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, e := range []string{"FOO=bar", "BAZ=qux", "RT_TEST_NAME=env"} {
+		if !strings.Contains(string(log), "Environment: "+e+"\n") {
+			t.Fatalf("%s was not logged:\n%s", e, log)
+		}
+	}
+	if strings.Contains(string(log), "DATABASE_URL") {
+		t.Fatalf("The inherited DATABASE_URL was logged:\n%s", log)
+	}
+}
@@ -0,0 +1,64 @@
+//go:build !windows
+// +build !windows
+
+package local
+
+import (
+	"os"
+	"os/exec"
+	"runtime"
+	"syscall"
+)
+
+// setProcessGroup makes the command the leader of a new process group so
+// that it and all of its children can be signalled together.
+func setProcessGroup(cmd *exec.Cmd) {
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+}
+
+// killProcessGroup kills the process group started by cmd
+func killProcessGroup(cmd *exec.Cmd) error {
+	if cmd.Process == nil {
+		return nil
+	}
+	return syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL)
+}
+
+// signalProcessGroup sends sig to the process group started by cmd
+func signalProcessGroup(cmd *exec.Cmd, sig os.Signal) error {
+	if cmd.Process == nil {
+		return nil
+	}
+	s, ok := sig.(syscall.Signal)
+	if !ok {
+		return killProcessGroup(cmd)
+	}
+	return syscall.Kill(-cmd.Process.Pid, s)
+}
+
+// sysUsage adds the resource usage reported by getrusage(2) to u
+func sysUsage(ps *os.ProcessState, u *Usage) {
+	ru, ok := ps.SysUsage().(*syscall.Rusage)
+	if !ok || ru == nil {
+		return
+	}
+	u.MaxRSS = int64(ru.Maxrss)
+	if runtime.GOOS != "darwin" {
+		// ru_maxrss is in bytes on macOS and in kilobytes elsewhere
+		u.MaxRSS *= 1024
+	}
+	u.MinorFaults = int64(ru.Minflt)
+	u.MajorFaults = int64(ru.Majflt)
+	u.VoluntaryContextSwitches = int64(ru.Nvcsw)
+	u.InvoluntaryContextSwitches = int64(ru.Nivcsw)
+}
+
+// exitSignal returns the name of the signal which terminated the process or
+// "" if it exited normally
+func exitSignal(ps *os.ProcessState) string {
+	ws, ok := ps.Sys().(syscall.WaitStatus)
+	if !ok || !ws.Signaled() {
+		return ""
+	}
+	return ws.Signal().String()
+}
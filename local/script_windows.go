@@ -0,0 +1,35 @@
+package local
+
+import (
+	"os"
+	"os/exec"
+)
+
+// setProcessGroup is a no-op on Windows
+func setProcessGroup(cmd *exec.Cmd) {
+}
+
+// killProcessGroup kills the process started by cmd. Windows has no process
+// groups so children of the process are not killed.
+func killProcessGroup(cmd *exec.Cmd) error {
+	if cmd.Process == nil {
+		return nil
+	}
+	return cmd.Process.Kill()
+}
+
+// signalProcessGroup kills the process started by cmd. Windows does not
+// support sending signals to other processes.
+func signalProcessGroup(cmd *exec.Cmd, sig os.Signal) error {
+	return killProcessGroup(cmd)
+}
+
+// sysUsage is a no-op on Windows, which only reports the CPU times
+func sysUsage(ps *os.ProcessState, u *Usage) {
+}
+
+// exitSignal always returns "" as processes are not terminated by signals on
+// Windows
+func exitSignal(ps *os.ProcessState) string {
+	return ""
+}
@@ -0,0 +1,80 @@
+package local
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+const (
+	// stepBeginMarker starts a line on stdout marking the start of a step
+	stepBeginMarker = "RT_STEP_BEGIN:"
+	// stepEndMarker starts a line on stdout marking the end of a step
+	stepEndMarker = "RT_STEP_END:"
+)
+
+// Step is a named part of a test, e.g. provisioning or booting a machine,
+// which is timed separately
+type Step struct {
+	Name      string        `json:"name"`
+	StartTime time.Time     `json:"start_time"`
+	Duration  time.Duration `json:"duration"`
+	// Incomplete is set if the step did not end before the test did
+	Incomplete bool `json:"incomplete,omitempty"`
+}
+
+// stepTracker times the steps marked in the output of a test. Steps may be
+// nested, and steps with the same name may be run several times.
+type stepTracker struct {
+	steps []Step
+	// open are the indices of the steps which have not ended yet, by name
+	open     map[string][]int
+	warnings []string
+}
+
+// parseLine checks a line of output for a step marker, seen at time t
+func (st *stepTracker) parseLine(line string, t time.Time) {
+	switch {
+	case strings.HasPrefix(line, stepBeginMarker):
+		st.begin(strings.TrimSpace(strings.TrimPrefix(line, stepBeginMarker)), t)
+	case strings.HasPrefix(line, stepEndMarker):
+		st.end(strings.TrimSpace(strings.TrimPrefix(line, stepEndMarker)), t)
+	}
+}
+
+func (st *stepTracker) begin(name string, t time.Time) {
+	if name == "" {
+		st.warnings = append(st.warnings, fmt.Sprintf("%s step without a name", stepBeginMarker))
+		return
+	}
+	if st.open == nil {
+		st.open = map[string][]int{}
+	}
+	st.open[name] = append(st.open[name], len(st.steps))
+	st.steps = append(st.steps, Step{Name: name, StartTime: t, Incomplete: true})
+}
+
+func (st *stepTracker) end(name string, t time.Time) {
+	open := st.open[name]
+	if len(open) == 0 {
+		st.warnings = append(st.warnings, fmt.Sprintf("%s step %q did not begin", stepEndMarker, name))
+		return
+	}
+	i := open[len(open)-1]
+	st.open[name] = open[:len(open)-1]
+	st.steps[i].Duration = t.Sub(st.steps[i].StartTime)
+	st.steps[i].Incomplete = false
+}
+
+// finish ends the steps which are still open at time t, when the test ended,
+// and returns all steps
+func (st *stepTracker) finish(t time.Time) []Step {
+	for i := range st.steps {
+		if st.steps[i].Incomplete {
+			st.steps[i].Duration = t.Sub(st.steps[i].StartTime)
+			st.warnings = append(st.warnings, fmt.Sprintf("step %q did not end", st.steps[i].Name))
+		}
+	}
+	st.open = nil
+	return st.steps
+}
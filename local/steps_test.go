@@ -0,0 +1,46 @@
+package local
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestStepTracker(t *testing.T) {
+	start := time.Date(2017, 5, 1, 12, 0, 0, 0, time.UTC)
+	at := func(s int) time.Time { return start.Add(time.Duration(s) * time.Second) }
+
+	var st stepTracker
+	st.parseLine("RT_STEP_BEGIN: provision", at(0))
+	st.parseLine("some output", at(1))
+	st.parseLine("RT_STEP_END: provision", at(10))
+	st.parseLine("RT_STEP_BEGIN: exercise", at(10))
+	st.parseLine("RT_STEP_BEGIN: request", at(11))
+	st.parseLine("RT_STEP_END: request", at(12))
+	st.parseLine("RT_STEP_BEGIN: request", at(12))
+	st.parseLine("RT_STEP_END: request", at(15))
+	st.parseLine("RT_STEP_END: exercise", at(20))
+	st.parseLine("RT_STEP_END: boot", at(20))
+	st.parseLine("RT_STEP_BEGIN:", at(20))
+	st.parseLine("RT_STEP_BEGIN: teardown", at(21))
+
+	steps := st.finish(at(25))
+	exp := []Step{
+		{Name: "provision", StartTime: at(0), Duration: 10 * time.Second},
+		{Name: "exercise", StartTime: at(10), Duration: 10 * time.Second},
+		{Name: "request", StartTime: at(11), Duration: time.Second},
+		{Name: "request", StartTime: at(12), Duration: 3 * time.Second},
+		{Name: "teardown", StartTime: at(21), Duration: 4 * time.Second, Incomplete: true},
+	}
+	if !reflect.DeepEqual(steps, exp) {
+		t.Fatalf("Expected %+v, got %+v", exp, steps)
+	}
+	expWarnings := []string{
+		`RT_STEP_END: step "boot" did not begin`,
+		"RT_STEP_BEGIN: step without a name",
+		`step "teardown" did not end`,
+	}
+	if !reflect.DeepEqual(st.warnings, expWarnings) {
+		t.Fatalf("Expected warnings %q, got %q", expWarnings, st.warnings)
+	}
+}
@@ -5,6 +5,7 @@ import (
 	"os"
 	"path/filepath"
 	"strings"
+	"time"
 
 	"github.com/linuxkit/rtf/logger"
 )
@@ -29,7 +30,7 @@ func IsTest(path string) bool {
 // Init initializes a test and should be run immmediately after NewTest
 func (t *Test) Init() error {
 	t.TestFilePath, _ = checkScript(t.Path, TestFileName)
-	tags, err := ParseTags(t.TestFilePath)
+	tags, err := scriptTags(t.TestFilePath)
 	if err != nil {
 		return err
 	}
@@ -40,6 +41,36 @@ func (t *Test) Init() error {
 		return fmt.Errorf("a test should have a parent group")
 	}
 	t.Tags.Name = fmt.Sprintf("%s.%s", t.Parent.Name(), name)
+	t.Repeat, t.LabelRepeat, err = parseRepeat(t.Tags.Repeat)
+	if err != nil {
+		return fmt.Errorf("%s: %v", t.TestFilePath, err)
+	}
+	env, err := parseEnvTag(t.Tags.Env)
+	if err != nil {
+		return fmt.Errorf("%s: %v", t.TestFilePath, err)
+	}
+	t.Env = append(append([]string{}, t.Parent.Env...), env...)
+	t.dependsOn = splitList(t.Tags.Depends)
+	t.Resources = splitList(t.Tags.Resources)
+	t.tmpCwd, err = parseWorkDir(t.Tags.WorkDir)
+	if err != nil {
+		return fmt.Errorf("%s: %v", t.TestFilePath, err)
+	}
+	if t.limits.memory, err = parseMemoryLimit(t.Tags.MemoryLimit); err != nil {
+		return fmt.Errorf("%s: %v", t.TestFilePath, err)
+	}
+	if t.limits.cpu, err = parseCPULimit(t.Tags.CPULimit); err != nil {
+		return fmt.Errorf("%s: %v", t.TestFilePath, err)
+	}
+	if t.sandbox, err = parseSandbox(t.Tags.Sandbox); err != nil {
+		return fmt.Errorf("%s: %v", t.TestFilePath, err)
+	}
+	if t.privateNetwork, err = parseNetwork(t.Tags.Network); err != nil {
+		return fmt.Errorf("%s: %v", t.TestFilePath, err)
+	}
+	if t.outputFormat, err = parseOutputFormat(t.Tags.OutputFormat); err != nil {
+		return fmt.Errorf("%s: %v", t.TestFilePath, err)
+	}
 	t.Labels, t.NotLabels = ParseLabels(t.Tags.Labels)
 	for k, v := range t.Parent.Labels {
 		if ok := t.Labels[k]; !ok {
@@ -71,6 +102,7 @@ func (t *Test) List(config RunConfig) []Info {
 		Name:      t.Name(),
 		Summary:   t.Tags.Summary,
 		Issue:     t.Tags.Issue,
+		Repeat:    t.repeat(config),
 		Labels:    t.Labels,
 		NotLabels: t.NotLabels,
 	}
@@ -83,7 +115,7 @@ func (t *Test) List(config RunConfig) []Info {
 
 // Gather satisfies the TestContainer interface
 func (t *Test) Gather(config RunConfig) ([]TestContainer, int) {
-	if len(config.restrictToTests) == 0 || config.restrictToTests[t.Name()] {
+	if config.restrictToTests == nil || config.restrictToTests[t.Name()] {
 		return []TestContainer{t}, 1
 	}
 	return nil, 0
@@ -95,27 +127,37 @@ func (t *Test) Run(config RunConfig) ([]Result, error) {
 	appendIteration := false
 
 	if !t.willRun(config) {
-		config.Logger.Log(logger.LevelSkip, fmt.Sprintf("%s %.2fs", t.Name(), 0.0))
-		return []Result{{Test: t,
-			Name:       t.Name(),
-			TestResult: Skip,
-		}}, nil
+		return t.skip("", config), nil
 	}
 	config.Logger.Log(logger.LevelInfo, fmt.Sprintf("Running test %s", t.Name()))
 
-	if t.Tags.Repeat == 0 {
+	repeat := t.repeat(config)
+	if repeat == 0 {
 		// Always run at least once
-		t.Tags.Repeat = 1
+		repeat = 1
 	} else {
 		appendIteration = true
 	}
 
-	for i := 1; i < t.Tags.Repeat+1; i++ {
+	for i := 1; i < repeat+1; i++ {
 		name := t.Name()
 		if appendIteration {
 			name = fmt.Sprintf("%s.%d", name, i)
 		}
 
+		if config.stopping() {
+			// Do not start new iterations once the run is stopping
+			config.Logger.LogResult(logger.LevelCancel, fmt.Sprintf("%s %.2fs", name, 0.0), t.logDetails(name))
+			now := time.Now()
+			results = append(results, Result{Test: t,
+				Name:       name,
+				TestResult: Cancel,
+				StartTime:  now,
+				EndTime:    now,
+			})
+			continue
+		}
+
 		logFileName := filepath.Join(config.LogDir, name+".log")
 		logFile, err := os.Create(logFileName)
 		if err != nil {
@@ -123,41 +165,73 @@ func (t *Test) Run(config RunConfig) ([]Result, error) {
 		}
 		testLogger := logger.NewFileLogger(logFile)
 		testLogger.SetLevel(logger.LevelDebug)
-		config.Logger.Register(logFileName, testLogger)
-		defer config.Logger.Unregister(logFileName)
+		// The log of the test only receives its own entries, not those of
+		// other tests running at the same time
+		testConfig := config
+		testConfig.Logger = logger.NewChildLogDispatcher(config.Logger, map[string]logger.Logger{logFileName: testLogger})
 
-		if t.Parent.PreTestPath != "" {
-			res, err := executeScript(t.Parent.PreTestPath, t.Path, name, []string{name}, config)
-			if res.TestResult != Pass {
-				return results, fmt.Errorf("error running: %s. %s", t.Parent.PreTestPath, err.Error())
+		retries := t.retries(config)
+		var res Result
+		for attempt := 1; attempt <= retries+1; attempt++ {
+			if attempt > 1 {
+				if config.stopping() {
+					break
+				}
+				testConfig.Logger.Log(logger.LevelInfo, fmt.Sprintf("Retrying test %s, attempt %d of %d", name, attempt, retries+1))
+			}
+			res, err = t.runAttempt(name, attempt, retries > 0, testConfig)
+			if err != nil {
+				return results, err
+			}
+			res.Attempts = attempt
+			if res.TestResult != Fail && res.TestResult != Timeout {
+				break
 			}
 		}
-		// Run the test
-		config.Logger.Log(logger.LevelInfo, fmt.Sprintf("Running Test %s in %s", name, t.Path))
-		res, err := executeScript(t.TestFilePath, t.Path, name, nil, config)
-		if err != nil {
-			return results, err
+		if res.Attempts > 1 && res.TestResult == Pass {
+			res.TestResult = Flaky
 		}
+
+		details := t.logDetails(res.Name)
+		details.Duration = res.Duration
+		details.Reason = res.Reason
+		details.Attempts = res.Attempts
+		details.Benchmark = res.BenchmarkResult
 		msg := fmt.Sprintf("%s %.2fs", res.Name, res.Duration.Seconds())
+		if res.Attempts > 1 {
+			msg = fmt.Sprintf("%s [attempts: %d]", msg, res.Attempts)
+		}
 		switch res.TestResult {
 		case Pass:
 			if res.BenchmarkResult != "" {
 				msg = msg + " [Benchmark: " + res.BenchmarkResult + "]"
 			}
-			config.Logger.Log(logger.LevelPass, msg)
+			testConfig.Logger.LogResult(logger.LevelPass, msg, details)
+		case Flaky:
+			if res.BenchmarkResult != "" {
+				msg = msg + " [Benchmark: " + res.BenchmarkResult + "]"
+			}
+			testConfig.Logger.LogResult(logger.LevelFlaky, msg, details)
 		case Fail:
 			if t.Tags.Issue != "" {
 				msg = msg + " [maybe: " + t.Tags.Issue + "]"
 			}
-			config.Logger.Log(logger.LevelFail, msg)
+			testConfig.Logger.LogResult(logger.LevelFail, msg, details)
 		case Cancel:
-			config.Logger.Log(logger.LevelCancel, msg)
-		}
-		if t.Parent.PostTestPath != "" {
-			res, err := executeScript(t.Parent.PostTestPath, t.Path, name, []string{name, fmt.Sprintf("%d", res.TestResult)}, config)
-			if res.TestResult != Pass {
-				return results, fmt.Errorf("error running: %s. %s", t.Parent.PostTestPath, err.Error())
+			testConfig.Logger.LogResult(logger.LevelCancel, msg, details)
+		case Skip:
+			if res.Reason != "" {
+				msg = fmt.Sprintf("%s [%s]", msg, res.Reason)
 			}
+			testConfig.Logger.LogResult(logger.LevelSkip, msg, details)
+		case Timeout:
+			if t.Tags.Issue != "" {
+				msg = msg + " [maybe: " + t.Tags.Issue + "]"
+			}
+			testConfig.Logger.LogResult(logger.LevelTimeout, msg, details)
+		}
+		if config.FailureLimit.add(res.TestResult) {
+			testConfig.Logger.Log(logger.LevelWarning, "Maximum number of failures reached, not starting any more tests")
 		}
 		res.Test = t
 		results = append(results, res)
@@ -165,11 +239,143 @@ func (t *Test) Run(config RunConfig) ([]Result, error) {
 	return results, nil
 }
 
+// runAttempt runs a single attempt of a test iteration together with the
+// pre-test and post-test scripts. If attemptLog is set, the output of the
+// attempt is also logged to a separate log file.
+func (t *Test) runAttempt(name string, attempt int, attemptLog bool, config RunConfig) (Result, error) {
+	if attemptLog {
+		logFileName := filepath.Join(config.LogDir, fmt.Sprintf("%s.attempt%d.log", name, attempt))
+		logFile, err := os.Create(logFileName)
+		if err != nil {
+			return Result{}, err
+		}
+		defer func() { _ = logFile.Close() }()
+		attemptLogger := logger.NewFileLogger(logFile)
+		attemptLogger.SetLevel(logger.LevelDebug)
+		config.Logger = logger.NewChildLogDispatcher(config.Logger, map[string]logger.Logger{logFileName: attemptLogger})
+	}
+
+	if attempt > 1 {
+		// Each attempt starts with an empty artifacts directory
+		if err := keepAttemptArtifacts(name, attempt-1, config); err != nil {
+			return Result{}, err
+		}
+	}
+
+	if t.Parent.PreTestPath != "" {
+		res, err := executeScript(t.Parent.PreTestPath, t.Path, name, []string{name}, scriptOptions{timeout: config.Timeout, env: t.Env}, config)
+		if err != nil {
+			return Result{}, fmt.Errorf("error running: %s. %s", t.Parent.PreTestPath, err.Error())
+		}
+		if res.TestResult != Pass {
+			return Result{}, fmt.Errorf("error running: %s", t.Parent.PreTestPath)
+		}
+	}
+	// Run the test
+	config.Logger.Log(logger.LevelInfo, fmt.Sprintf("Running Test %s in %s", name, t.Path))
+	opts := scriptOptions{
+		timeout:    t.timeout(config),
+		env:        t.Env,
+		scratch:    true,
+		tmpCwd:     t.tmpCwd,
+		artifacts:  true,
+		cgroup:     true,
+		resultFile: true,
+		limits:     t.limits,
+		sandbox:    t.sandboxed(config),
+		// Only applies in the sandbox
+		privateNetwork: t.privateNetwork,
+		outputFormat:   t.outputFormat,
+	}
+	res, err := executeScript(t.TestFilePath, t.Path, name, nil, opts, config)
+	if err != nil {
+		return Result{}, err
+	}
+	if t.Parent.PostTestPath != "" {
+		postRes, err := executeScript(t.Parent.PostTestPath, t.Path, name, []string{name, fmt.Sprintf("%d", res.TestResult)}, scriptOptions{timeout: config.Timeout, env: t.Env}, config)
+		if err != nil {
+			return Result{}, fmt.Errorf("error running: %s. %s", t.Parent.PostTestPath, err.Error())
+		}
+		if postRes.TestResult != Pass {
+			return Result{}, fmt.Errorf("error running: %s", t.Parent.PostTestPath)
+		}
+	}
+	return res, nil
+}
+
+// skip returns the result for a test which is not run for the given reason
+func (t *Test) skip(reason string, config RunConfig) []Result {
+	msg := fmt.Sprintf("%s %.2fs", t.Name(), 0.0)
+	if reason != "" {
+		msg = fmt.Sprintf("%s [%s]", msg, reason)
+	}
+	details := t.logDetails(t.Name())
+	details.Reason = reason
+	config.Logger.LogResult(logger.LevelSkip, msg, details)
+	return []Result{{Test: t,
+		Name:       t.Name(),
+		TestResult: Skip,
+		Reason:     reason,
+	}}
+}
+
+// logDetails returns the details of a result of the test which are logged
+func (t *Test) logDetails(name string) logger.Details {
+	return logger.Details{Name: name, Labels: t.LabelString(), Issue: t.Tags.Issue}
+}
+
 // Order returns a tests order
 func (t *Test) Order() int {
 	return t.order
 }
 
+// timeout returns the timeout for the test, falling back to the default from the RunConfig
+func (t *Test) timeout(config RunConfig) time.Duration {
+	if t.Tags.Timeout > 0 {
+		return t.Tags.Timeout
+	}
+	return config.Timeout
+}
+
+// repeat returns how often the test should be run given the labels in the
+// RunConfig. If one or more labels with a repeat count are set, the largest of
+// their counts is used, otherwise the plain REPEAT count. 0 means that no
+// repeat count was specified.
+func (t *Test) repeat(config RunConfig) int {
+	repeat := t.Repeat
+	matched := false
+	for l, n := range t.LabelRepeat {
+		if !config.Labels[l] {
+			continue
+		}
+		if !matched || n > repeat {
+			repeat = n
+		}
+		matched = true
+	}
+	return repeat
+}
+
+// sandboxed determines if the test runs in a sandbox, which is set by its
+// SANDBOX tag, falling back to the RunConfig
+func (t *Test) sandboxed(config RunConfig) bool {
+	switch t.sandbox {
+	case sandboxOn:
+		return true
+	case sandboxOff:
+		return false
+	}
+	return config.Sandbox
+}
+
+// retries returns how often a failed test is retried, falling back to the default from the RunConfig
+func (t *Test) retries(config RunConfig) int {
+	if t.Tags.Retries > 0 {
+		return t.Tags.Retries
+	}
+	return config.Retries
+}
+
 // willRun determines if the test should be run based on labels and runtime config.
 func (t *Test) willRun(config RunConfig) bool {
 	if !CheckLabel(t.Labels, t.NotLabels, config) {
@@ -177,5 +383,5 @@ func (t *Test) willRun(config RunConfig) bool {
 	}
 
 	// HasPrefix matches on "" for config.TestPattern
-	return strings.HasPrefix(t.Name(), config.TestPattern)
+	return strings.HasPrefix(t.Name(), config.TestPattern) || config.prerequisites[t.Name()]
 }
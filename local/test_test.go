@@ -73,3 +73,20 @@ func TestTestPattern(t *testing.T) {
 		fmt.Printf("Name: %s Summary: %s CheckLabel: %d\n", tst.Name, tst.Summary, tst.TestResult)
 	}
 }
+
+func TestRepeat(t *testing.T) {
+	tst := &Test{Repeat: 1, LabelRepeat: map[string]int{"release": 20, "soak": 200}}
+	for _, tt := range []struct {
+		labels map[string]bool
+		repeat int
+	}{
+		{nil, 1},
+		{map[string]bool{"linux": true}, 1},
+		{map[string]bool{"release": true}, 20},
+		{map[string]bool{"release": true, "soak": true}, 200},
+	} {
+		if repeat := tst.repeat(RunConfig{Labels: tt.labels}); repeat != tt.repeat {
+			t.Fatalf("Expected %d iterations with labels %v, got %d", tt.repeat, tt.labels, repeat)
+		}
+	}
+}
@@ -2,7 +2,11 @@
 # AUTHOR: Rolf Neugebauer <rolf.neugebauer@docker.com>
 # SUMMARY: A Test
 # LABELS: foo, bar, !baz
-# REPEAT: 5
+# REPEAT: 5 release:20
+# TIMEOUT: 90s
+# RETRIES: 2
+# RESOURCES: docker, port:8080
+# EXCLUSIVE:
 # ISSUE: https://github.com/linuxkit/rtf/issues/1
 # ISSUE: https://github.com/linuxkit/rtf/issues/2
 
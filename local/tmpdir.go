@@ -0,0 +1,107 @@
+package local
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/linuxkit/rtf/logger"
+)
+
+// KeepTmp determines when the scratch directory of a test is kept
+type KeepTmp int
+
+const (
+	// KeepTmpOnFailure keeps the scratch directory of tests which did not pass,
+	// unless they were skipped
+	KeepTmpOnFailure KeepTmp = iota
+	// KeepTmpAlways keeps all scratch directories
+	KeepTmpAlways
+	// KeepTmpNever deletes all scratch directories
+	KeepTmpNever
+)
+
+// KeepTmpNames provides a mapping of KeepTmp values to the names used on the command line
+var KeepTmpNames = map[KeepTmp]string{
+	KeepTmpOnFailure: "on-failure",
+	KeepTmpAlways:    "always",
+	KeepTmpNever:     "never",
+}
+
+// ParseKeepTmp parses the name of a KeepTmp value
+func ParseKeepTmp(s string) (KeepTmp, error) {
+	for k, name := range KeepTmpNames {
+		if s == name {
+			return k, nil
+		}
+	}
+	return KeepTmpOnFailure, fmt.Errorf("invalid value %q, expected always, never or on-failure", s)
+}
+
+const (
+	// workDirSource runs a test in its source directory
+	workDirSource = "source"
+	// workDirTmp runs a test in its scratch directory
+	workDirTmp = "tmp"
+)
+
+// parseWorkDir validates the WORKDIR tag and returns true if the test should
+// run in its scratch directory
+func parseWorkDir(s string) (bool, error) {
+	switch strings.TrimSpace(s) {
+	case "", workDirSource:
+		return false, nil
+	case workDirTmp:
+		return true, nil
+	}
+	return false, fmt.Errorf("invalid WORKDIR %q, expected %s or %s", s, workDirSource, workDirTmp)
+}
+
+// ScratchDirName is the directory in the result directory which holds the
+// scratch directories of the running tests
+const ScratchDirName = ".tmp"
+
+// newScratchDir creates a fresh scratch directory for a script. It is created
+// in the result directory, so that it can be kept by simply renaming it.
+func newScratchDir(name string, config RunConfig) (string, error) {
+	parent := os.TempDir()
+	if config.LogDir != "" {
+		parent = filepath.Join(config.LogDir, ScratchDirName)
+		if err := os.MkdirAll(parent, 0755); err != nil {
+			return "", err
+		}
+	}
+	dir, err := ioutil.TempDir(parent, name+".")
+	if err != nil {
+		return "", err
+	}
+	return filepath.Abs(dir)
+}
+
+// cleanupScratchDir deletes the scratch directory of a script or, depending on
+// config.KeepTmp and the result, moves it into the result directory
+func cleanupScratchDir(dir, name string, res TestResult, config RunConfig) {
+	failed := res != Pass && res != Skip
+	keep := config.KeepTmp == KeepTmpAlways || (config.KeepTmp == KeepTmpOnFailure && failed)
+	if !keep {
+		if err := os.RemoveAll(dir); err != nil {
+			config.Logger.Log(logger.LevelError, fmt.Sprintf("Failed to remove %s: %v", dir, err))
+		}
+		return
+	}
+
+	dest := filepath.Join(config.LogDir, name+".tmp")
+	for i := 2; ; i++ {
+		if _, err := os.Lstat(dest); os.IsNotExist(err) {
+			break
+		}
+		dest = filepath.Join(config.LogDir, fmt.Sprintf("%s.tmp.%d", name, i))
+	}
+	if err := os.Rename(dir, dest); err != nil {
+		config.Logger.Log(logger.LevelWarning, fmt.Sprintf("Failed to move %s to %s: %v", dir, dest, err))
+		dest = dir
+	}
+	config.Logger.Log(logger.LevelInfo, fmt.Sprintf("Kept scratch directory of %s in %s", name, dest))
+}
@@ -0,0 +1,33 @@
+package local
+
+import "testing"
+
+func TestParseKeepTmp(t *testing.T) {
+	for k, name := range KeepTmpNames {
+		got, err := ParseKeepTmp(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != k {
+			t.Fatalf("Expected %s to parse as %d, got %d", name, k, got)
+		}
+	}
+	if _, err := ParseKeepTmp("sometimes"); err == nil {
+		t.Fatalf("Expected an error for an invalid value")
+	}
+}
+
+func TestParseWorkDir(t *testing.T) {
+	for s, exp := range map[string]bool{"": false, "source": false, "tmp": true, " tmp ": true} {
+		got, err := parseWorkDir(s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != exp {
+			t.Fatalf("Expected %q to parse as %v, got %v", s, exp, got)
+		}
+	}
+	if _, err := parseWorkDir("/tmp"); err == nil {
+		t.Fatalf("Expected an error for an invalid WORKDIR")
+	}
+}
@@ -2,10 +2,8 @@ package local
 
 import (
 	"fmt"
-	"os"
 	"os/exec"
-	"path/filepath"
-	"runtime"
+	"strconv"
 	"time"
 
 	"github.com/fatih/color"
@@ -24,30 +22,6 @@ const (
 	TestFileName = "test"
 )
 
-// checkScript checks if a script with 'name' exists in 'path'
-func checkScript(path, name string) (string, error) {
-	// On Windows, powershell scripts take precedence.
-	if runtime.GOOS == "windows" {
-		f := filepath.Join(path, name+".ps1")
-		if _, err := os.Stat(f); err == nil {
-			return f, nil
-		}
-	}
-
-	f := filepath.Join(path, name+".sh")
-	if _, err := os.Stat(f); err != nil {
-		// On non-windows, shell scripts take precedence but we check for powershell too
-		if runtime.GOOS != "windows" {
-			f := filepath.Join(path, name+".ps1")
-			if _, err := os.Stat(f); err == nil {
-				return f, nil
-			}
-		}
-		return "", err
-	}
-	return f, nil
-}
-
 // Project is a group of tests and other groups with a few higher level functions
 type Project struct {
 	*Group
@@ -66,6 +40,7 @@ type Group struct {
 	order         int
 	Labels        map[string]bool
 	NotLabels     map[string]bool
+	Env           []string
 	Children      []TestContainer
 }
 
@@ -77,11 +52,23 @@ type Test struct {
 	TestFilePath string
 	Command      exec.Cmd
 	Repeat       int
+	LabelRepeat  map[string]int
 	order        int
 	Summary      string
 	Author       string
 	Labels       map[string]bool
 	NotLabels    map[string]bool
+	Env          []string
+	Depends      []*Test
+	Resources    []string
+	dependsOn    []string
+	// tmpCwd is set if the test runs in its scratch directory
+	tmpCwd bool
+	limits resourceLimits
+	// sandbox overrides RunConfig.Sandbox if set
+	sandbox        int
+	privateNetwork bool
+	outputFormat   string
 }
 
 // TestResult is the result of a test run
@@ -96,14 +83,20 @@ const (
 	Skip
 	// Cancel is a test cancellation
 	Cancel
+	// Timeout is a test that was killed because it exceeded its timeout
+	Timeout
+	// Flaky is a test that failed at first but passed when it was retried
+	Flaky
 )
 
 // TestResultNames provides a mapping of numerical result values to human readable strings
 var TestResultNames = map[TestResult]string{
-	Pass:   "Pass",
-	Fail:   "Fail",
-	Skip:   "Skip",
-	Cancel: "Cancel",
+	Pass:    "Pass",
+	Fail:    "Fail",
+	Skip:    "Skip",
+	Cancel:  "Cancel",
+	Timeout: "Timeout",
+	Flaky:   "Flaky",
 }
 
 // Sprintf prints the arguments using fmt.Sprintf but colours it depending on the TestResult
@@ -111,9 +104,9 @@ func (r TestResult) Sprintf(format string, a ...interface{}) string {
 	switch r {
 	case Pass:
 		return color.GreenString(format, a...)
-	case Fail:
+	case Fail, Timeout:
 		return color.RedString(format, a...)
-	case Cancel:
+	case Cancel, Flaky:
 		return color.YellowString(format, a...)
 	case Skip:
 		return color.YellowString(format, a...)
@@ -129,10 +122,29 @@ type Result struct {
 	Test            *Test         `json:"-"`
 	Name            string        `json:"name,omitempty"` // Name may be different to Test.Name() for repeated tests.
 	TestResult      TestResult    `json:"result"`
+	Reason          string        `json:"reason,omitempty"`
 	BenchmarkResult string        `json:"benchmark,omitempty"`
 	StartTime       time.Time     `json:"start,omitempty"`
 	EndTime         time.Time     `json:"end,omitempty"`
 	Duration        time.Duration `json:"duration,omitempty"`
+	Attempts        int           `json:"attempts,omitempty"`
+	ResourceWait    time.Duration `json:"resource_wait,omitempty"`
+	Artifacts       []Artifact    `json:"artifacts,omitempty"`
+	// ExitCode is the exit code of the test script or -1 if it was
+	// terminated by a signal
+	ExitCode int    `json:"exit_code,omitempty"`
+	Signal   string `json:"signal,omitempty"`
+	Usage    *Usage `json:"usage,omitempty"`
+	// Cgroup is only set if the test ran in its own cgroup
+	Cgroup *CgroupUsage `json:"cgroup,omitempty"`
+	// Reported by the test in its RT_RESULT_FILE
+	Metrics    map[string]Metric `json:"metrics,omitempty"`
+	Notes      []string          `json:"notes,omitempty"`
+	Warnings   []string          `json:"warnings,omitempty"`
+	Links      []Link            `json:"links,omitempty"`
+	SubResults []SubResult       `json:"sub_results,omitempty"`
+	// Steps are the timed parts of the test marked in its output
+	Steps []Step `json:"steps,omitempty"`
 }
 
 // Info encapsulates the information necessary to list tests and test groups
@@ -141,6 +153,7 @@ type Info struct {
 	TestResult TestResult
 	Summary    string
 	Issue      string
+	Repeat     int
 	Labels     map[string]bool
 	NotLabels  map[string]bool
 }
@@ -150,6 +163,14 @@ func (i *Info) LabelString() string {
 	return makeLabelString(i.Labels, i.NotLabels, ", ")
 }
 
+// RepeatString returns the number of times a test will be run as a string
+func (i *Info) RepeatString() string {
+	if i.Repeat == 0 {
+		return "1"
+	}
+	return strconv.Itoa(i.Repeat)
+}
+
 // OSInfo contains information about the OS the tests are running on
 type OSInfo struct {
 	OS      string
@@ -168,9 +189,26 @@ type RunConfig struct {
 	Labels          map[string]bool
 	NotLabels       map[string]bool
 	TestPattern     string
-	Parallel        bool
+	Jobs            int
 	IncludeInit     bool
+	Timeout         time.Duration
+	Retries         int
+	Env             []string
+	Interrupt       *Interrupt
+	FailureLimit    *FailureLimit
+	KeepTmp         KeepTmp
+	Cgroups         *Cgroups
+	Sandbox         bool
 	restrictToTests map[string]bool
+	// prerequisites are the tests which are run because selected tests
+	// depend on them
+	prerequisites map[string]bool
+}
+
+// stopping returns true if no new tests should be started, either because the
+// run was interrupted or because too many tests have failed
+func (c RunConfig) stopping() bool {
+	return c.Interrupt.Interrupted() || c.FailureLimit.Reached()
 }
 
 // GroupCommand is a command that is runnable, either a test or pre/post script.
@@ -179,6 +217,7 @@ type GroupCommand struct {
 	Type     string
 	FilePath string
 	Path     string
+	Env      []string
 }
 
 // TestContainer is a container that can hold one or more tests
@@ -203,10 +242,11 @@ func (a ByOrder) Less(i, j int) bool { return a[i].Order() < a[j].Order() }
 
 // Summary contains a summary of a whole run, mostly used for writing out a JSON file
 type Summary struct {
-	ID         string             `json:"id,omitempty"`
-	StartTime  time.Time          `json:"start,omitempty"`
-	EndTime    time.Time          `json:"end,omitempty"`
-	SystemInfo sysinfo.SystemInfo `json:"system,omitempty"`
-	Labels     []string           `json:"labels,omitempty"`
-	Results    []Result           `json:"results,omitempty"`
+	ID          string             `json:"id,omitempty"`
+	StartTime   time.Time          `json:"start,omitempty"`
+	EndTime     time.Time          `json:"end,omitempty"`
+	SystemInfo  sysinfo.SystemInfo `json:"system,omitempty"`
+	Labels      []string           `json:"labels,omitempty"`
+	Interrupted bool               `json:"interrupted,omitempty"`
+	Results     []Result           `json:"results,omitempty"`
 }
@@ -0,0 +1,37 @@
+package local
+
+import (
+	"fmt"
+	"os"
+	"time"
+)
+
+// Usage is the resource usage of a script, including the processes it
+// waited for. Only the CPU times are available on Windows.
+type Usage struct {
+	UserTime   time.Duration `json:"user_time"`
+	SystemTime time.Duration `json:"system_time"`
+	// MaxRSS is the maximum resident set size in bytes
+	MaxRSS                     int64 `json:"max_rss,omitempty"`
+	MinorFaults                int64 `json:"minor_faults,omitempty"`
+	MajorFaults                int64 `json:"major_faults,omitempty"`
+	VoluntaryContextSwitches   int64 `json:"voluntary_context_switches,omitempty"`
+	InvoluntaryContextSwitches int64 `json:"involuntary_context_switches,omitempty"`
+}
+
+// newUsage returns the resource usage of an exited process
+func newUsage(ps *os.ProcessState) *Usage {
+	u := &Usage{
+		UserTime:   ps.UserTime(),
+		SystemTime: ps.SystemTime(),
+	}
+	sysUsage(ps, u)
+	return u
+}
+
+// String returns a human readable summary of the resource usage
+func (u *Usage) String() string {
+	return fmt.Sprintf("user %.2fs, system %.2fs, max RSS %d KB, page faults %d minor/%d major, context switches %d voluntary/%d involuntary",
+		u.UserTime.Seconds(), u.SystemTime.Seconds(), u.MaxRSS/1024,
+		u.MinorFaults, u.MajorFaults, u.VoluntaryContextSwitches, u.InvoluntaryContextSwitches)
+}
@@ -17,6 +17,9 @@ type LogLevel int
 // LogDispatcher dispatches logs to multiple Loggers
 type LogDispatcher interface {
 	Log(level LogLevel, msg string)
+	// LogResult logs the result of a test, passing its details to the
+	// backends which are DetailLoggers
+	LogResult(level LogLevel, msg string, d Details)
 	Register(name string, backend Logger)
 	Unregister(name string)
 }
@@ -29,6 +32,23 @@ type Logger interface {
 	SetLevel(level LogLevel)
 }
 
+// Details are the details of a test result, which some backends log in
+// addition to the message
+type Details struct {
+	Name      string
+	Duration  time.Duration
+	Labels    string
+	Issue     string
+	Reason    string
+	Attempts  int
+	Benchmark string
+}
+
+// A DetailLogger is a Logger which also logs the details of test results
+type DetailLogger interface {
+	LogDetails(timestamp time.Time, level LogLevel, msg string, d Details)
+}
+
 const (
 	// LevelCritical represents the Critical Log Level
 	LevelCritical = 100
@@ -41,9 +61,9 @@ const (
 	// LevelDebug represents the Debug log level
 	LevelDebug = 500
 	// LevelStderr represents the Stderr log level
-	LevelStderr = LevelWarning + 6
+	LevelStderr = LevelWarning + 8
 	// LevelStdout represents the Stdout log level
-	LevelStdout = LevelWarning + 7
+	LevelStdout = LevelWarning + 9
 	// LevelSkip represents the Skip log level
 	LevelSkip = LevelWarning + 1
 	// LevelPass represents the Pass log level
@@ -52,8 +72,12 @@ const (
 	LevelCancel = LevelWarning + 3
 	// LevelFail represents the Fail log level
 	LevelFail = LevelWarning + 4
+	// LevelTimeout represents the Timeout log level
+	LevelTimeout = LevelWarning + 5
+	// LevelFlaky represents the Flaky log level
+	LevelFlaky = LevelWarning + 6
 	// LevelSummary represents the Summary log level
-	LevelSummary = LevelWarning + 5
+	LevelSummary = LevelWarning + 7
 )
 
 // LevelNames maps LogLevels to a string representation of their names
@@ -69,11 +93,24 @@ var LevelNames = map[LogLevel]string{
 	LevelPass:     "PASS",
 	LevelCancel:   "CANCEL",
 	LevelFail:     "FAIL",
+	LevelTimeout:  "TIMEOUT",
+	LevelFlaky:    "FLAKY",
 	LevelSummary:  "SUMMARY",
 }
 
+// isResultLevel determines if a log level is the result of a test
+func isResultLevel(level LogLevel) bool {
+	switch level {
+	case LevelPass, LevelFail, LevelSkip, LevelCancel, LevelTimeout, LevelFlaky:
+		return true
+	}
+	return false
+}
+
 type logDispatcher struct {
 	Backends map[string]Logger
+	// parent also receives all log entries, if set
+	parent LogDispatcher
 	sync.RWMutex
 }
 
@@ -85,6 +122,27 @@ func (d *logDispatcher) Log(level LogLevel, msg string) {
 	for _, b := range d.Backends {
 		b.Log(timestamp, level, msg)
 	}
+	if d.parent != nil {
+		d.parent.Log(level, msg)
+	}
+}
+
+// LogResult dispatches a test result to each backend, with its details if the
+// backend is a DetailLogger
+func (d *logDispatcher) LogResult(level LogLevel, msg string, details Details) {
+	d.RLock()
+	defer d.RUnlock()
+	timestamp := time.Now()
+	for _, b := range d.Backends {
+		if dl, ok := b.(DetailLogger); ok {
+			dl.LogDetails(timestamp, level, msg, details)
+		} else {
+			b.Log(timestamp, level, msg)
+		}
+	}
+	if d.parent != nil {
+		d.parent.LogResult(level, msg, details)
+	}
 }
 
 func (d *logDispatcher) Register(name string, backend Logger) {
@@ -104,6 +162,14 @@ func NewLogDispatcher(backends map[string]Logger) LogDispatcher {
 	return &logDispatcher{Backends: backends}
 }
 
+// NewChildLogDispatcher returns a new LogDispatcher which logs to the provided
+// backend Loggers and to its parent. Backends registered with the child do not
+// receive the entries logged with the parent or its other children, e.g. of
+// other tests running at the same time.
+func NewChildLogDispatcher(parent LogDispatcher, backends map[string]Logger) LogDispatcher {
+	return &logDispatcher{Backends: backends, parent: parent}
+}
+
 // LogFormatter formats log entries in to a string
 type LogFormatter interface {
 	Format(timestamp time.Time, level LogLevel, msg string) string
@@ -167,6 +233,8 @@ var defaultColourMap = ColourMap{
 	LevelPass:     color.New(color.FgGreen, color.Bold).SprintFunc(),
 	LevelCancel:   color.New(color.FgMagenta, color.Bold).SprintFunc(),
 	LevelFail:     color.New(color.FgRed, color.Bold).SprintFunc(),
+	LevelTimeout:  color.New(color.FgRed, color.Bold).SprintFunc(),
+	LevelFlaky:    color.New(color.FgYellow, color.Bold).SprintFunc(),
 }
 
 // Format formats the log for writing to console
@@ -179,7 +247,7 @@ func (c consoleLogFormatter) Format(timestamp time.Time, level LogLevel, msg str
 	}
 	var s string
 	switch level {
-	case LevelPass, LevelFail, LevelSkip, LevelSummary, LevelCancel:
+	case LevelPass, LevelFail, LevelSkip, LevelSummary, LevelCancel, LevelTimeout, LevelFlaky:
 		s = fmt.Sprintf("%s %s\n", l, msg)
 	default:
 		// Format is time.RFC3339Nano but with trailing zeroes preserved on the nanosecond field (s/9/0/)
@@ -1,13 +1,15 @@
 package logger
 
 import (
+	"bytes"
 	"os"
+	"path/filepath"
 	"testing"
 	"time"
 )
 
 func TestFileLogger(t *testing.T) {
-	f, err := os.Create("foo.log")
+	f, err := os.Create(filepath.Join(t.TempDir(), "foo.log"))
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -36,5 +38,77 @@ func generateLogEntries(l Logger) {
 	l.Log(time.Now(), LevelFail, "test")
 	l.Log(time.Now(), LevelSkip, "test")
 	l.Log(time.Now(), LevelCancel, "test")
+	l.Log(time.Now(), LevelTimeout, "test")
+	l.Log(time.Now(), LevelFlaky, "test")
 	l.Log(time.Now(), LevelSummary, "test")
 }
+
+func TestTAPLogger(t *testing.T) {
+	var b bytes.Buffer
+	l := NewTAPLogger(&b)
+	d := NewLogDispatcher(map[string]Logger{"TAP": l})
+	d.Log(LevelInfo, "not logged")
+	d.LogResult(LevelPass, "a.b 1.50s", Details{Name: "a.b", Duration: 1500 * time.Millisecond, Labels: "x, !y"})
+	d.LogResult(LevelFail, "a.c 0.00s", Details{Name: "a.c", Issue: "https://example.com/1"})
+	d.LogResult(LevelSkip, "a.#d 0.00s [no]", Details{Name: "a.#d", Reason: "no"})
+	d.Log(LevelCancel, "a.e 0.00s")
+	d.Log(LevelSummary, "Passed: 1")
+	l.End()
+
+	expected := `TAP version 14
+ok 1 - a.b
+  ---
+  result: pass
+  duration_ms: 1500.000
+  labels: "x, !y"
+  ...
+not ok 2 - a.c
+  ---
+  result: fail
+  duration_ms: 0.000
+  issue: "https://example.com/1"
+  ...
+ok 3 - a.\#d # SKIP no
+  ---
+  result: skip
+  duration_ms: 0.000
+  reason: "no"
+  ...
+ok 4 - a.e # SKIP cancelled
+  ---
+  result: cancel
+  duration_ms: 0.000
+  ...
+# Passed: 1
+1..4
+`
+	if b.String() != expected {
+		t.Errorf("Expected:\n%s\nGot:\n%s", expected, b.String())
+	}
+}
+
+func TestChildLogDispatcher(t *testing.T) {
+	var parentLog, aLog, bLog bytes.Buffer
+	newLogger := func(b *bytes.Buffer) Logger {
+		return &logger{consoleLogFormatter{}, ioLogWriter{b}, LevelDebug}
+	}
+	parent := NewLogDispatcher(map[string]Logger{"parent": newLogger(&parentLog)})
+	a := NewChildLogDispatcher(parent, map[string]Logger{"a": newLogger(&aLog)})
+	b := NewChildLogDispatcher(parent, map[string]Logger{"b": newLogger(&bLog)})
+	parent.Log(LevelSummary, "parent")
+	a.Log(LevelSummary, "a")
+	b.LogResult(LevelPass, "b", Details{Name: "b"})
+
+	for _, tc := range []struct {
+		log      *bytes.Buffer
+		expected string
+	}{
+		{&parentLog, "[SUMMARY ] parent\n[SUMMARY ] a\n[PASS    ] b\n"},
+		{&aLog, "[SUMMARY ] a\n"},
+		{&bLog, "[PASS    ] b\n"},
+	} {
+		if tc.log.String() != tc.expected {
+			t.Errorf("Expected:\n%s\nGot:\n%s", tc.expected, tc.log.String())
+		}
+	}
+}
@@ -0,0 +1,137 @@
+package logger
+
+import (
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// tapEscaper escapes the characters which have a meaning in the description
+// of a TAP test point
+var tapEscaper = strings.NewReplacer(`\`, `\\`, "#", `\#`, "\n", " ")
+
+// TAPLogger logs the results of tests as a TAP version 14 stream. Each result
+// is a test point with its details in a YAML block, other log entries up to
+// the log level are comments. As the number of tests is not known when the
+// stream starts, the plan is written at its end by End.
+type TAPLogger struct {
+	writer      io.Writer
+	levelFilter LogLevel
+	// count is the number of test points written so far
+	count   int
+	started bool
+	sync.Mutex
+}
+
+// NewTAPLogger returns a new logger that writes a TAP stream to w
+func NewTAPLogger(w io.Writer) *TAPLogger {
+	return &TAPLogger{writer: w, levelFilter: LevelSummary}
+}
+
+// Log logs a test result as a test point and other entries as comments.
+// Results logged without their details only have a name, the first word of
+// the message.
+func (t *TAPLogger) Log(timestamp time.Time, level LogLevel, msg string) {
+	if isResultLevel(level) {
+		var d Details
+		if f := strings.Fields(msg); len(f) > 0 {
+			d.Name = f[0]
+		}
+		t.LogDetails(timestamp, level, msg, d)
+		return
+	}
+	if level > t.levelFilter {
+		return
+	}
+	t.Lock()
+	defer t.Unlock()
+	t.Write(t.Format(timestamp, level, msg))
+}
+
+// LogDetails logs a test result as a test point
+func (t *TAPLogger) LogDetails(timestamp time.Time, level LogLevel, msg string, d Details) {
+	if level > t.levelFilter {
+		return
+	}
+	t.Lock()
+	defer t.Unlock()
+	t.count++
+	t.Write(formatTestPoint(t.count, level, d))
+}
+
+// SetLevel sets maximum logging level. Test results are only logged if it
+// is at least LevelSummary.
+func (t *TAPLogger) SetLevel(level LogLevel) {
+	t.levelFilter = level
+}
+
+// Format formats a log entry as a TAP comment
+func (t *TAPLogger) Format(timestamp time.Time, level LogLevel, msg string) string {
+	var s strings.Builder
+	for _, l := range strings.Split(strings.TrimRight(msg, "\n"), "\n") {
+		s.WriteString(strings.TrimRight("# "+l, " ") + "\n")
+	}
+	return s.String()
+}
+
+// Write writes an entry to the stream, starting it with the version line
+func (t *TAPLogger) Write(entry string) {
+	if !t.started {
+		t.started = true
+		ioLogWriter{t.writer}.Write("TAP version 14\n")
+	}
+	ioLogWriter{t.writer}.Write(entry)
+}
+
+// End ends the stream with the plan, the number of test points written
+func (t *TAPLogger) End() {
+	t.Lock()
+	defer t.Unlock()
+	t.Write(fmt.Sprintf("1..%d\n", t.count))
+}
+
+// BailOut ends the stream early as the run could not be completed
+func (t *TAPLogger) BailOut(reason string) {
+	t.Lock()
+	defer t.Unlock()
+	t.Write(strings.TrimSpace("Bail out! "+strings.Replace(reason, "\n", " ", -1)) + "\n")
+}
+
+// formatTestPoint formats the nth test point for a test result. Skipped and
+// cancelled tests have a SKIP directive. Failed tests have no directive, even
+// with an issue, as a TODO directive would let the stream pass.
+func formatTestPoint(n int, level LogLevel, d Details) string {
+	status := "ok"
+	var directive string
+	switch level {
+	case LevelFail, LevelTimeout:
+		status = "not ok"
+	case LevelSkip:
+		directive = "SKIP " + d.Reason
+	case LevelCancel:
+		directive = "SKIP cancelled"
+	}
+	s := fmt.Sprintf("%s %d - %s", status, n, tapEscaper.Replace(d.Name))
+	if directive != "" {
+		s += " # " + tapEscaper.Replace(strings.TrimSpace(directive))
+	}
+	s += "\n  ---\n"
+	s += fmt.Sprintf("  result: %s\n", strings.ToLower(LevelNames[level]))
+	s += fmt.Sprintf("  duration_ms: %s\n", strconv.FormatFloat(float64(d.Duration)/float64(time.Millisecond), 'f', 3, 64))
+	yamlString := func(key, value string) {
+		if value != "" {
+			s += fmt.Sprintf("  %s: %s\n", key, strconv.Quote(value))
+		}
+	}
+	yamlString("labels", d.Labels)
+	yamlString("issue", d.Issue)
+	yamlString("reason", d.Reason)
+	if d.Attempts > 1 {
+		s += fmt.Sprintf("  attempts: %d\n", d.Attempts)
+	}
+	yamlString("benchmark", d.Benchmark)
+	return s + "  ...\n"
+}
@@ -14,8 +14,13 @@
 
 package main
 
-import "github.com/linuxkit/rtf/cmd"
+import (
+	"github.com/linuxkit/rtf/cmd"
+	"github.com/linuxkit/rtf/local"
+)
 
 func main() {
+	// Sets up the sandbox of a test if rtf was re-executed to do so
+	local.SandboxMain()
 	cmd.Execute()
 }